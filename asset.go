@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// AssetManifest maps the name of every asset written so far, relative to
+	// the source directory, to the URL it was written under.
+	AssetManifest = map[string]string{}
+
+	// AssetManifestFile is where WriteAssetManifest writes the manifest,
+	// relative to the target directory.
+	AssetManifestFile = "asset-manifest.json"
+
+	// Targets maps every file written to the target directory to the source
+	// file it's written from (target: source). GatherSource records sources
+	// and pages, and ClaimTarget generated files.
+	Targets = map[string]string{}
+)
+
+// Fingerprinted reports whether files with the given name are written under
+// fingerprinted names, according to the -fingerprint flag.
+func Fingerprinted(name string) bool {
+	ext := filepath.Ext(name)
+	for _, fingerprintExt := range strings.Split(*fingerprint, ",") {
+		if fingerprintExt = strings.TrimSpace(fingerprintExt); fingerprintExt != "" && fingerprintExt == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// FingerprintName inserts a short hash of buf before the extension of name,
+// e.g. style.css becomes style.3fa9c1e2.css.
+func FingerprintName(name string, buf []byte) string {
+	sum := sha256.Sum256(buf)
+	ext := filepath.Ext(name)
+	return name[:len(name)-len(ext)] + "." + hex.EncodeToString(sum[:4]) + ext
+}
+
+// WriteAsset writes buf as the asset name (relative to the source directory)
+// to the target directory, minified and fingerprinted as configured, records
+// it in the AssetManifest, and returns its URL. Each asset is written once.
+func WriteAsset(name string, buf []byte) string {
+	name = filepath.ToSlash(strings.TrimPrefix(name, "/"))
+	if url, ok := AssetManifest[name]; ok {
+		return url
+	}
+	if *minify {
+		buf = Minify(name, buf)
+	}
+	targetName := name
+	if Fingerprinted(name) {
+		targetName = FingerprintName(name, buf)
+	}
+	dst := filepath.Join(*targetDir, filepath.FromSlash(targetName))
+	Write(dst, buf)
+	url := "/" + targetName
+	AssetManifest[name] = url
+	Debugf("asset %s written to %s", name, dst)
+	return url
+}
+
+// AssetName resolves the name of an asset referred to by the file at path:
+// names beginning with "/" are relative to the source directory; otherwise,
+// they're relative to the directory of the file. The result is relative to
+// the source directory, which it must be in, like readFile's.
+func AssetName(path, name string) (string, error) {
+	filename := filepath.Join(filepath.Dir(path), filepath.FromSlash(name))
+	if strings.HasPrefix(name, "/") {
+		filename = filepath.Join(*sourceDir, filepath.FromSlash(name))
+	}
+	if !strings.HasPrefix(filename, *sourceDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("asset %s is outside of the source directory", name)
+	}
+	return filepath.ToSlash(Relative(*sourceDir, filename)), nil
+}
+
+// Asset returns the URL of the asset name, writing it if it hasn't been
+// written yet. Names are resolved by AssetName.
+func Asset(path, name string) (string, error) {
+	name, err := AssetName(path, name)
+	if err != nil {
+		return "", err
+	}
+	if url, ok := AssetManifest[name]; ok {
+		return url, nil
+	}
+	filename := filepath.Join(*sourceDir, filepath.FromSlash(name))
+	if info, err := os.Stat(filename); err != nil || info.IsDir() {
+		return "", fmt.Errorf("asset %s doesn't exist", name)
+	}
+	return WriteAsset(name, Read(filename)), nil
+}
+
+// Integrity returns the Subresource Integrity hash ("sha384-...") of the
+// asset name, as written to the target directory. Names are resolved like
+// Asset resolves them.
+func Integrity(path, name string) (string, string, error) {
+	url, err := Asset(path, name)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha512.Sum384(Read(filepath.Join(*targetDir, filepath.FromSlash(url))))
+	return url, "sha384-" + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// ScriptTag returns a script element for the asset name, with its integrity.
+func ScriptTag(path, name string) (template.HTML, error) {
+	url, integrity, err := Integrity(path, name)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(fmt.Sprintf(
+		`<script src="%s" integrity="%s" crossorigin="anonymous"></script>`,
+		html.EscapeString(url), integrity,
+	)), nil
+}
+
+// StylesheetTag returns a stylesheet link element for the asset name, with
+// its integrity.
+func StylesheetTag(path, name string) (template.HTML, error) {
+	url, integrity, err := Integrity(path, name)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(fmt.Sprintf(
+		`<link rel="stylesheet" href="%s" integrity="%s" crossorigin="anonymous">`,
+		html.EscapeString(url), integrity,
+	)), nil
+}
+
+// WriteAssetManifest writes the AssetManifest to the target directory as
+// JSON, if any assets are fingerprinted.
+func WriteAssetManifest() {
+	if *fingerprint == "" {
+		return
+	}
+	buf, err := json.MarshalIndent(AssetManifest, "", "    ")
+	if err != nil {
+		Fatalf("asset manifest: %s", err)
+	}
+	Write(filepath.Join(*targetDir, AssetManifestFile), buf)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFingerprintName(t *testing.T) {
+	buf := []byte("body { margin: 0 }")
+	got := FingerprintName("css/style.css", buf)
+	if expected := "css/style.997facec.css"; expected != got {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+	if again := FingerprintName("css/style.css", buf); got != again {
+		t.Errorf("not deterministic: %s, then %s", got, again)
+	}
+	if other := FingerprintName("css/style.css", []byte("body{}")); got == other {
+		t.Errorf("different content, same name %s", got)
+	}
+}
+
+func TestAsset(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "grender-test-asset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(src, tgt, fp string) { *sourceDir, *targetDir, *fingerprint = src, tgt, fp }(*sourceDir, *targetDir, *fingerprint)
+	*sourceDir, *targetDir, *fingerprint = filepath.Join(dir, "src"), filepath.Join(dir, "tgt"), ".css"
+
+	buf := []byte("body { margin: 0 }")
+	Write(filepath.Join(*sourceDir, "css", "style.css"), buf)
+	Write(filepath.Join(*sourceDir, "img", "logo.png"), []byte("PNG"))
+	page := filepath.Join(*sourceDir, "blog", "index.html")
+
+	expected := "/" + FingerprintName("css/style.css", buf)
+	for _, name := range []string{"../css/style.css", "/css/style.css"} {
+		url, err := Asset(page, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected != url {
+			t.Errorf("%s: expected %s, got %s", name, expected, url)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(*targetDir, expected)); err != nil {
+		t.Errorf("fingerprinted asset not written: %s", err)
+	}
+
+	if url, err := Asset(page, "/img/logo.png"); err != nil || url != "/img/logo.png" {
+		t.Errorf("expected /img/logo.png, got %s (%v)", url, err)
+	}
+	if _, err := Asset(page, "missing.css"); err == nil {
+		t.Errorf("expected error for missing asset, got none")
+	}
+	Write(filepath.Join(dir, "secret.css"), []byte("secret"))
+	for _, name := range []string{"../../secret.css", "/../secret.css"} {
+		if _, err := Asset(page, name); err == nil {
+			t.Errorf("%s: expected error for asset outside of the source directory, got none", name)
+		}
+	}
+}
+
+func TestScriptTag(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "grender-test-integrity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(src, tgt string) { *sourceDir, *targetDir = src, tgt }(*sourceDir, *targetDir)
+	*sourceDir, *targetDir = filepath.Join(dir, "src"), filepath.Join(dir, "tgt")
+
+	buf := []byte("alert(1);")
+	Write(filepath.Join(*sourceDir, "js", "app.js"), buf)
+	sum := sha512.Sum384(buf)
+	integrity := "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+
+	got, err := ScriptTag(filepath.Join(*sourceDir, "index.html"), "js/app.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<script src="/js/app.js" integrity="` + integrity + `" crossorigin="anonymous"></script>`
+	if expected != string(got) {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// builtBundles records the inputs of every bundle written so far, keyed
+	// by bundle name, so each is written only once per build.
+	builtBundles = map[string]string{}
+)
+
+// Bundles returns the bundle declarations in the "bundles" metadata key, which
+// maps bundle names to lists of input files. Both are relative to the source
+// directory: the bundle "css/site.css" is written to css/site.css in the
+// target directory.
+func Bundles(metadata map[string]interface{}) (map[string][]string, error) {
+	bundles := map[string][]string{}
+	declared, ok := metadata["bundles"]
+	if !ok {
+		return bundles, nil
+	}
+	m, ok := declared.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("bundles must be a map of names to lists of files")
+	}
+	for name, inputs := range m {
+		list, ok := toStrings(inputs)
+		if !ok {
+			return nil, fmt.Errorf("bundle %s: inputs must be a list of files", name)
+		}
+		bundles[strings.TrimPrefix(name, "/")] = list
+	}
+	return bundles, nil
+}
+
+// BuildBundle concatenates the inputs of the named bundle, declared in the
+// metadata, into the target directory, and returns the bundle's URL. Each
+// bundle is only written once per build; declaring the same bundle with
+// different inputs, or a bundle which would overwrite another file in
+// Targets, is an error.
+func BuildBundle(metadata map[string]interface{}, name string) (string, error) {
+	name = strings.TrimPrefix(name, "/")
+	bundles, err := Bundles(metadata)
+	if err != nil {
+		return "", err
+	}
+	inputs, ok := bundles[name]
+	if !ok {
+		return "", fmt.Errorf("bundle %s isn't declared", name)
+	}
+
+	signature := strings.Join(inputs, "\n")
+	if built, ok := builtBundles[name]; ok {
+		if built != signature {
+			return "", fmt.Errorf("bundle %s is declared with different inputs", name)
+		}
+		return AssetManifest[name], nil
+	}
+	if err := ClaimTarget(filepath.Join(*targetDir, filepath.FromSlash(name)), "bundle "+name); err != nil {
+		return "", err
+	}
+
+	buf := bytes.Buffer{}
+	for _, input := range inputs {
+		buf.Write(Read(filepath.Join(*sourceDir, filepath.FromSlash(input))))
+		buf.WriteString("\n")
+	}
+	url := WriteAsset(name, buf.Bytes())
+	builtBundles[name] = signature
+	Debugf("bundle %s written to %s (%d input(s))", name, url, len(inputs))
+	return url, nil
+}
+
+// BuildBundles builds every bundle declared in the metadata.
+func BuildBundles(path string, metadata map[string]interface{}) {
+	bundles, err := Bundles(metadata)
+	if err != nil {
+		Fatalf("%s: %s", path, err)
+	}
+	for name := range bundles {
+		if _, err := BuildBundle(metadata, name); err != nil {
+			Fatalf("%s: %s", path, err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildBundle(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "grender-test-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(src, tgt string) { *sourceDir, *targetDir = src, tgt }(*sourceDir, *targetDir)
+	*sourceDir, *targetDir = filepath.Join(dir, "src"), filepath.Join(dir, "tgt")
+	defer func(targets map[string]string) { Targets = targets }(Targets)
+	Targets = map[string]string{}
+
+	Write(filepath.Join(*sourceDir, "css", "a.css"), []byte("a { color: red; }"))
+	Write(filepath.Join(*sourceDir, "css", "b.css"), []byte("b { color: blue; }"))
+	metadata := ParseJSON([]byte(`{"bundles": {"/all.css": ["css/a.css", "css/b.css"]}}`))
+
+	url, err := BuildBundle(metadata, "all.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "/all.css"; expected != url {
+		t.Errorf("expected URL %s, got %s", expected, url)
+	}
+	expected := "a { color: red; }\nb { color: blue; }\n"
+	if got := string(Read(filepath.Join(*targetDir, "all.css"))); expected != got {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	if _, err := BuildBundle(metadata, "other.css"); err == nil {
+		t.Errorf("undeclared bundle: expected error, got none")
+	}
+	changed := ParseJSON([]byte(`{"bundles": {"all.css": ["css/b.css"]}}`))
+	if _, err := BuildBundle(changed, "all.css"); err == nil {
+		t.Errorf("redeclared bundle: expected error, got none")
+	}
+
+	Targets[filepath.Join(*targetDir, "css", "a.css")] = filepath.Join(*sourceDir, "css", "a.css")
+	colliding := ParseJSON([]byte(`{"bundles": {"css/a.css": ["css/b.css"]}}`))
+	if _, err := BuildBundle(colliding, "css/a.css"); err == nil {
+		t.Errorf("bundle overwriting a source file: expected error, got none")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// Cascades holds the cascades declared by .json files, by the Stack key
+	// of their directory, in the order they were declared.
+	Cascades = map[string][]Cascade{}
+)
+
+// Cascade is metadata which a .json file gives to only some of the source
+// files beneath its directory, declared under its "cascade" key:
+//
+//	{
+//	  "cascade": [
+//	    { "match": "**/*.md", "metadata": { "template": "entry.template" } },
+//	    { "match": "2013-*", "where": [["draft", "!=", true]], "metadata": { "archived": true } }
+//	  ]
+//	}
+//
+// A source file gets the metadata if its path, relative to the directory,
+// matches the glob in "match" (see MatchGlob), and its metadata passes every
+// test in "where", each of which is the key, optional operator and value of
+// the where template function. Either may be omitted.
+type Cascade struct {
+	Name     string // for Provenance
+	Dir      string
+	Match    string
+	Where    [][]interface{}
+	Metadata map[string]interface{}
+}
+
+// ParseCascades returns the cascades declared in metadata, read from the .json
+// file at path, which is named name.
+func ParseCascades(path, name string, metadata map[string]interface{}) ([]Cascade, error) {
+	declared, ok := metadata["cascade"]
+	if !ok {
+		return []Cascade{}, nil
+	}
+	list, ok := declared.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cascade must be a list")
+	}
+	cascades := []Cascade{}
+	for i, element := range list {
+		m, ok := element.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cascade %d must be a map", i+1)
+		}
+		c := Cascade{
+			Name: fmt.Sprintf("%s (cascade %d)", name, i+1),
+			Dir:  filepath.Dir(path),
+		}
+		if c.Metadata, ok = m["metadata"].(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("cascade %d: metadata must be a map", i+1)
+		}
+		if match, ok := m["match"]; ok {
+			if c.Match, ok = match.(string); !ok {
+				return nil, fmt.Errorf("cascade %d: match must be a glob", i+1)
+			}
+			if err := checkGlob(c.Match); err != nil {
+				return nil, fmt.Errorf("cascade %d: bad match %q: %s", i+1, c.Match, err)
+			}
+		}
+		if where, ok := m["where"]; ok {
+			tests, ok := where.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("cascade %d: where must be a list of tests", i+1)
+			}
+			for _, test := range tests {
+				args, ok := test.([]interface{})
+				if !ok || len(args) < 2 || len(args) > 3 {
+					return nil, fmt.Errorf("cascade %d: bad test %v: expected key, optional operator and value", i+1, test)
+				}
+				if _, err := whereTest(args, []interface{}{map[string]interface{}{}}); err != nil {
+					return nil, fmt.Errorf("cascade %d: %s", i+1, err)
+				}
+				c.Where = append(c.Where, args)
+			}
+		}
+		cascades = append(cascades, c)
+	}
+	return cascades, nil
+}
+
+// Matches reports whether the source file at path, with the given metadata,
+// gets the cascade's metadata.
+func (c Cascade) Matches(path string, metadata map[string]interface{}) bool {
+	if !strings.HasPrefix(path, c.Dir+string(filepath.Separator)) {
+		return false
+	}
+	if c.Match != "" {
+		if ok, _ := MatchGlob(c.Match, filepath.ToSlash(Relative(c.Dir, path))); !ok {
+			return false
+		}
+	}
+	for _, args := range c.Where {
+		if matched, _ := whereTest(args, []interface{}{metadata}); len(matched) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// whereTest applies the test args, the arguments of the where template function
+// but its collection, to items.
+func whereTest(args []interface{}, items []interface{}) ([]interface{}, error) {
+	rest := append(append([]interface{}{}, args[1:]...), items)
+	return Where(fmt.Sprint(args[0]), rest...)
+}
+
+// CascadesFor returns the cascades which give metadata to the source file at
+// path, with the given metadata, from the source directory down.
+func CascadesFor(path string, metadata map[string]interface{}) []Cascade {
+	cascades := []Cascade{}
+	for _, key := range StackPaths(path) {
+		for _, c := range Cascades[key] {
+			if c.Matches(path, metadata) {
+				cascades = append(cascades, c)
+			}
+		}
+	}
+	return cascades
+}
+
+// CascadeLayers returns the metadata of cascades by the Stack key of their
+// directories, for GetLayered.
+func CascadeLayers(cascades []Cascade) map[string][]map[string]interface{} {
+	layers := map[string][]map[string]interface{}{}
+	for _, c := range cascades {
+		key := StackKey(c.Dir)
+		layers[key] = append(layers[key], c.Metadata)
+	}
+	return layers
+}
+
+// MatchGlob reports whether name, a slash-separated path, matches pattern.
+// It's path.Match, except that "**" matches any number of directories, and a
+// pattern without a slash matches the last element of name, wherever it is.
+func MatchGlob(pattern, name string) (bool, error) {
+	if !strings.Contains(pattern, "/") {
+		return path.Match(pattern, path.Base(name))
+	}
+	return matchElements(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// checkGlob returns path.ErrBadPattern if any element of pattern is malformed.
+func checkGlob(pattern string) error {
+	for _, element := range strings.Split(pattern, "/") {
+		if _, err := path.Match(element, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func matchElements(pattern, name []string) (bool, error) {
+	for ; len(pattern) > 0; pattern, name = pattern[1:], name[1:] {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if ok, err := matchElements(pattern[1:], name[i:]); ok || err != nil {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			_, err := path.Match(pattern[0], "")
+			return false, err
+		}
+		if ok, err := path.Match(pattern[0], name[0]); !ok || err != nil {
+			return false, err
+		}
+	}
+	return len(name) == 0, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	for _, tuple := range []struct {
+		pattern, name string
+		expected      bool
+	}{
+		{"*.md", "a.md", true},
+		{"*.md", "blog/2013/a.md", true},
+		{"*.md", "a.html", false},
+		{"2013-*", "blog/2013-06-01-hello.md", true},
+		{"2013-*", "2014-01-01-hello.md", false},
+		{"**/*.md", "a.md", true},
+		{"**/*.md", "blog/2013/a.md", true},
+		{"**/*.md", "blog/a.html", false},
+		{"blog/*.md", "blog/a.md", true},
+		{"blog/*.md", "blog/2013/a.md", false},
+		{"blog/**", "blog/2013/a.md", true},
+		{"blog/**/a.md", "blog/a.md", true},
+		{"blog/**/a.md", "blog/x/y/a.md", true},
+		{"blog/**/a.md", "docs/a.md", false},
+	} {
+		got, err := MatchGlob(tuple.pattern, tuple.name)
+		if err != nil {
+			t.Errorf("%s: %s", tuple.pattern, err)
+		}
+		if got != tuple.expected {
+			t.Errorf("%s, %s: expected %v, got %v", tuple.pattern, tuple.name, tuple.expected, got)
+		}
+	}
+}
+
+func TestParseCascades(t *testing.T) {
+	for _, bad := range []string{
+		`{"cascade": {"match": "*.md"}}`,
+		`{"cascade": [{"match": "*.md"}]}`,
+		`{"cascade": [{"match": "a/[", "metadata": {}}]}`,
+		`{"cascade": [{"where": [["draft"]], "metadata": {}}]}`,
+		`{"cascade": [{"where": [["draft", "~", true]], "metadata": {}}]}`,
+	} {
+		if _, err := ParseCascades("/src/_.json", "_.json", ParseJSON([]byte(bad))); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestCascades(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "grender-test-cascade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(src, tgt string) { *sourceDir, *targetDir = src, tgt }(*sourceDir, *targetDir)
+	defer func(cascades map[string][]Cascade) { Cascades = cascades }(Cascades)
+	*sourceDir, *targetDir = filepath.Join(dir, "src"), filepath.Join(dir, "tgt")
+	Cascades = map[string][]Cascade{}
+
+	Write(filepath.Join(*sourceDir, "_.json"), []byte(`{
+		"template": "page.template",
+		"cascade": [
+			{"match": "**/*.md", "metadata": {"template": "entry.template", "tags": {"$append": "md"}}},
+			{"match": "2013-*", "where": [["kind", "post"]], "metadata": {"archived": true}}
+		]
+	}`))
+	Write(filepath.Join(*sourceDir, "blog", "_.json"), []byte(`{
+		"kind": "post",
+		"tags": ["blog"],
+		"cascade": [{"match": "2013-*", "metadata": {"archived": "blog"}}]
+	}`))
+	Write(filepath.Join(*sourceDir, "blog", "drafts", "_.json"), []byte(`{"template": "draft.template"}`))
+	Write(filepath.Join(*sourceDir, "blog", "drafts", "2013-07-01-wip.md"), []byte("{}\n---\nwip"))
+	Write(filepath.Join(*sourceDir, "blog", "2013-06-01-old.md"), []byte("{}\n---\nold"))
+	Write(filepath.Join(*sourceDir, "blog", "2014-06-01-new.md"), []byte(`{"template": "special.template"}`+"\n---\nnew"))
+	Write(filepath.Join(*sourceDir, "docs", "2013-notes.md"), []byte("notes"))
+	Write(filepath.Join(*sourceDir, "index.html"), []byte("index"))
+
+	s := NewStack()
+	if err := filepath.Walk(*sourceDir, GatherJSON(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := filepath.Walk(*sourceDir, GatherSource(s, map[string]interface{}{}, map[string]string{})); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]map[string]interface{}{
+		// blog/_.json is deeper than the cascades of _.json, so it wins, and
+		// so does its own cascade; blog/drafts/_.json is deeper still.
+		"blog/2013-06-01-old.md":        {"template": "entry.template", "tags": []interface{}{"blog"}, "archived": "blog"},
+		"blog/2014-06-01-new.md":        {"template": "special.template", "tags": []interface{}{"blog"}, "archived": nil},
+		"blog/drafts/2013-07-01-wip.md": {"template": "draft.template", "tags": []interface{}{"blog"}, "archived": "blog"},
+		"docs/2013-notes.md":            {"template": "entry.template", "tags": []interface{}{"md"}, "archived": nil},
+		"index.html":                    {"template": "page.template", "tags": nil, "archived": nil},
+	} {
+		metadata := s.Get(filepath.Join(*sourceDir, name))
+		for k, v := range expected {
+			if !reflect.DeepEqual(v, metadata[k]) {
+				t.Errorf("%s: %s: expected %v, got %v", name, k, v, metadata[k])
+			}
+		}
+		if _, ok := metadata["cascade"]; ok {
+			t.Errorf("%s: cascade is in its metadata", name)
+		}
+	}
+
+	path := filepath.Join(*sourceDir, "blog", "drafts", "2013-07-01-wip.md")
+	provenance := s.Provenance(path)
+	for k, expected := range map[string][]string{
+		"archived": {"_.json (cascade 2)", "blog/_.json (cascade 1)"},
+		"template": {"_.json", "_.json (cascade 1)", "blog/drafts/_.json"},
+	} {
+		if got := provenance[k].Layers; !reflect.DeepEqual(expected, got) {
+			t.Errorf("%s: expected layers %v, got %v", k, expected, got)
+		}
+	}
+	for k, p := range provenance {
+		if v := s.Get(path)[k]; !reflect.DeepEqual(v, p.Value) {
+			t.Errorf("%s: Get returns %v, Provenance %v", k, v, p.Value)
+		}
+	}
+}
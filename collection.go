@@ -0,0 +1,359 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Group is a set of collection items which share a value, as returned by
+// GroupBy.
+type Group struct {
+	Key   interface{}
+	Items []interface{}
+}
+
+// Items returns the elements of a collection: the values of a map, such as
+// the ones SplatInto builds, ordered by their names, or the elements of a
+// slice, in order.
+func Items(collection interface{}) ([]interface{}, error) {
+	if m, ok := collection.(map[string]interface{}); ok {
+		names := []string{}
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		items := []interface{}{}
+		for _, name := range names {
+			items = append(items, m[name])
+		}
+		return items, nil
+	}
+	v := reflect.ValueOf(collection)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		items := []interface{}{}
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, v.Index(i).Interface())
+		}
+		return items, nil
+	case reflect.Invalid:
+		return []interface{}{}, nil
+	}
+	return nil, fmt.Errorf("%T isn't a collection", collection)
+}
+
+// SortBy orders a collection by the value of key in each item, ascending
+// ("asc", the default) or descending ("desc"). Items without the key come
+// last. Call it as sortBy KEY [ORDER] COLLECTION.
+func SortBy(key string, args ...interface{}) ([]interface{}, error) {
+	order := "asc"
+	switch len(args) {
+	case 1:
+	case 2:
+		var ok bool
+		if order, ok = args[0].(string); !ok || order != "asc" && order != "desc" {
+			return nil, fmt.Errorf("sortBy: order must be asc or desc, not %v", args[0])
+		}
+	default:
+		return nil, fmt.Errorf("sortBy: expected key, optional order, and collection")
+	}
+	items, err := Items(args[len(args)-1])
+	if err != nil {
+		return nil, fmt.Errorf("sortBy: %s", err)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, aok := field(items[i], key)
+		b, bok := field(items[j], key)
+		if !aok || !bok {
+			return aok
+		}
+		c, _ := compare(a, b)
+		if order == "desc" {
+			return c > 0
+		}
+		return c < 0
+	})
+	return items, nil
+}
+
+// Where returns the items of a collection whose value of key satisfies the
+// operator op against value. The operators are ==, !=, <, <=, >, >=, in and
+// "not in" (the value is a list), and contains (the item's value is a list or
+// string). Call it as where KEY [OP] VALUE COLLECTION; OP defaults to ==.
+func Where(key string, args ...interface{}) ([]interface{}, error) {
+	op := "=="
+	switch len(args) {
+	case 2:
+	case 3:
+		var ok bool
+		if op, ok = args[0].(string); !ok {
+			return nil, fmt.Errorf("where: bad operator %v", args[0])
+		}
+		args = args[1:]
+	default:
+		return nil, fmt.Errorf("where: expected key, optional operator, value and collection")
+	}
+	value := args[0]
+	items, err := Items(args[1])
+	if err != nil {
+		return nil, fmt.Errorf("where: %s", err)
+	}
+	result := []interface{}{}
+	for _, item := range items {
+		v, _ := field(item, key)
+		ok, err := match(v, op, value)
+		if err != nil {
+			return nil, fmt.Errorf("where %s %s %v: %s", key, op, value, err)
+		}
+		if ok {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+// First returns the first n items of a collection.
+func First(n int, collection interface{}) ([]interface{}, error) {
+	items, err := Items(collection)
+	if err != nil {
+		return nil, fmt.Errorf("first: %s", err)
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("first: negative count %d", n)
+	}
+	if n < len(items) {
+		items = items[:n]
+	}
+	return items, nil
+}
+
+// Last returns the last n items of a collection.
+func Last(n int, collection interface{}) ([]interface{}, error) {
+	items, err := Items(collection)
+	if err != nil {
+		return nil, fmt.Errorf("last: %s", err)
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("last: negative count %d", n)
+	}
+	if n < len(items) {
+		items = items[len(items)-n:]
+	}
+	return items, nil
+}
+
+// Limit returns at most n items of a collection, skipping the first offset,
+// if it's given. Call it as limit N [OFFSET] COLLECTION.
+func Limit(n int, args ...interface{}) ([]interface{}, error) {
+	offset := 0
+	switch len(args) {
+	case 1:
+	case 2:
+		f, ok := number(args[0])
+		if !ok || f < 0 || f != float64(int(f)) {
+			return nil, fmt.Errorf("limit: bad offset %v", args[0])
+		}
+		offset = int(f)
+	default:
+		return nil, fmt.Errorf("limit: expected count, optional offset, and collection")
+	}
+	items, err := Items(args[len(args)-1])
+	if err != nil {
+		return nil, fmt.Errorf("limit: %s", err)
+	}
+	if offset > len(items) {
+		offset = len(items)
+	}
+	return First(n, items[offset:])
+}
+
+// Reverse returns the items of a collection in reverse order.
+func Reverse(collection interface{}) ([]interface{}, error) {
+	items, err := Items(collection)
+	if err != nil {
+		return nil, fmt.Errorf("reverse: %s", err)
+	}
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return items, nil
+}
+
+// GroupBy groups the items of a collection by their value of key, in order of
+// first appearance, so sort the collection first. If an item has no such key,
+// "year", "month" and "day" are derived from its date, formatted as 2006,
+// 2006-01 and 2006-01-02. Items without a value, or with a null one, aren't
+// grouped at all.
+func GroupBy(key string, collection interface{}) ([]Group, error) {
+	items, err := Items(collection)
+	if err != nil {
+		return nil, fmt.Errorf("groupBy: %s", err)
+	}
+	groups := []Group{}
+	index := map[interface{}]int{}
+	for _, item := range items {
+		v, ok := field(item, key)
+		if !ok || v == nil {
+			continue
+		}
+		if t, isTime := v.(time.Time); isTime {
+			v = t.Format(time.RFC3339Nano)
+		}
+		if !reflect.TypeOf(v).Comparable() {
+			return nil, fmt.Errorf("groupBy: can't group by %s %v", key, v)
+		}
+		i, ok := index[v]
+		if !ok {
+			i = len(groups)
+			index[v] = i
+			groups = append(groups, Group{Key: v})
+		}
+		groups[i].Items = append(groups[i].Items, item)
+	}
+	return groups, nil
+}
+
+// dateParts are the keys GroupBy derives from an item's date.
+var dateParts = map[string]string{"year": "2006", "month": "2006-01", "day": "2006-01-02"}
+
+// field returns the value of key in a collection item, which must be a map.
+func field(item interface{}, key string) (interface{}, bool) {
+	m, ok := item.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	if v, ok := m[key]; ok {
+		return v, true
+	}
+	if layout, ok := dateParts[key]; ok {
+		if date, ok := ToDate(m["date"]); ok {
+			return date.In(DateLocation).Format(layout), true
+		}
+	}
+	return nil, false
+}
+
+// match reports whether v op value holds.
+func match(v interface{}, op string, value interface{}) (bool, error) {
+	switch op {
+	case "==", "=", "eq":
+		c, ok := compare(v, value)
+		return ok && c == 0, nil
+	case "!=", "ne":
+		c, ok := compare(v, value)
+		return !ok || c != 0, nil
+	case "<", "<=", ">", ">=", "lt", "le", "gt", "ge":
+		c, ok := compare(v, value)
+		if !ok {
+			return false, nil
+		}
+		switch op {
+		case "<", "lt":
+			return c < 0, nil
+		case "<=", "le":
+			return c <= 0, nil
+		case ">", "gt":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "in", "not in":
+		list, err := Items(value)
+		if err != nil {
+			return false, err
+		}
+		return contains(list, v) == (op == "in"), nil
+	case "contains":
+		if s, ok := v.(string); ok {
+			sub, ok := value.(string)
+			return ok && strings.Contains(s, sub), nil
+		}
+		list, err := Items(v)
+		if err != nil {
+			return false, nil
+		}
+		return contains(list, value), nil
+	}
+	return false, fmt.Errorf("unknown operator")
+}
+
+func contains(list []interface{}, value interface{}) bool {
+	for _, element := range list {
+		if c, ok := compare(element, value); ok && c == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// compare compares two metadata values of the same kind: numbers, dates
+// (including strings which parse as dates, compared with a time.Time),
+// strings, or booleans. It returns false if they can't be compared.
+func compare(a, b interface{}) (int, bool) {
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			return compareFloats(x, y), true
+		}
+		return 0, false
+	}
+	_, aTime := a.(time.Time)
+	_, bTime := b.(time.Time)
+	if aTime || bTime {
+		x, xok := ToDate(a)
+		y, yok := ToDate(b)
+		if !xok || !yok {
+			return 0, false
+		}
+		switch {
+		case x.Before(y):
+			return -1, true
+		case x.After(y):
+			return 1, true
+		}
+		return 0, true
+	}
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return strings.Compare(x, y), ok
+	case bool:
+		y, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x == y:
+			return 0, true
+		case y:
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// number converts any Go number to a float64, if possible.
+func number(i interface{}) (float64, bool) {
+	v := reflect.ValueOf(i)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
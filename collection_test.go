@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func testCollection() map[string]interface{} {
+	date := func(s string) time.Time {
+		t, _ := time.Parse("2006-01-02", s)
+		return t
+	}
+	return map[string]interface{}{
+		"a.md": map[string]interface{}{"title": "A", "date": date("2013-01-02"), "tags": []interface{}{"go"}, "weight": 2.0},
+		"b.md": map[string]interface{}{"title": "B", "date": date("2014-05-06"), "tags": []interface{}{"web"}, "weight": 1.0},
+		"c.md": map[string]interface{}{"title": "C", "date": date("2013-07-08"), "tags": []interface{}{"go", "web"}},
+		"d.md": map[string]interface{}{"title": "D", "draft": true},
+	}
+}
+
+func titles(items []interface{}) []string {
+	result := []string{}
+	for _, item := range items {
+		title, _ := field(item, "title")
+		result = append(result, title.(string))
+	}
+	return result
+}
+
+func TestSortBy(t *testing.T) {
+	for _, tuple := range []struct {
+		args     []interface{}
+		expected []string
+	}{
+		{[]interface{}{testCollection()}, []string{"A", "C", "B", "D"}},
+		{[]interface{}{"desc", testCollection()}, []string{"B", "C", "A", "D"}},
+	} {
+		items, err := SortBy("date", tuple.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := titles(items); !reflect.DeepEqual(tuple.expected, got) {
+			t.Errorf("%v: expected %v, got %v", tuple.args[:len(tuple.args)-1], tuple.expected, got)
+		}
+	}
+	items, _ := SortBy("weight", testCollection())
+	if expected, got := []string{"B", "A", "C", "D"}, titles(items); !reflect.DeepEqual(expected, got) {
+		t.Errorf("weight: expected %v, got %v", expected, got)
+	}
+	if _, err := SortBy("date", "sideways", testCollection()); err == nil {
+		t.Errorf("expected error for bad order, got none")
+	}
+}
+
+func TestWhere(t *testing.T) {
+	for _, tuple := range []struct {
+		key      string
+		args     []interface{}
+		expected []string
+	}{
+		{"title", []interface{}{"B"}, []string{"B"}},
+		{"draft", []interface{}{"!=", true}, []string{"A", "B", "C"}},
+		{"weight", []interface{}{">=", 2}, []string{"A"}},
+		{"date", []interface{}{"<", "2014-01-01"}, []string{"A", "C"}},
+		{"title", []interface{}{"in", []interface{}{"A", "D"}}, []string{"A", "D"}},
+		{"title", []interface{}{"not in", []string{"A", "D"}}, []string{"B", "C"}},
+		{"tags", []interface{}{"contains", "web"}, []string{"B", "C"}},
+		{"year", []interface{}{"2013"}, []string{"A", "C"}},
+	} {
+		items, err := Where(tuple.key, append(tuple.args, testCollection())...)
+		if err != nil {
+			t.Errorf("%s %v: %s", tuple.key, tuple.args, err)
+			continue
+		}
+		if got := titles(items); !reflect.DeepEqual(tuple.expected, got) {
+			t.Errorf("%s %v: expected %v, got %v", tuple.key, tuple.args, tuple.expected, got)
+		}
+	}
+	if _, err := Where("title", "~", "A", testCollection()); err == nil {
+		t.Errorf("expected error for bad operator, got none")
+	}
+}
+
+func TestFirstLastLimitReverse(t *testing.T) {
+	c := testCollection()
+	for name, f := range map[string]func() ([]interface{}, error){
+		"first 2":   func() ([]interface{}, error) { return First(2, c) },
+		"first 9":   func() ([]interface{}, error) { return First(9, []interface{}{c["a.md"]}) },
+		"last 2":    func() ([]interface{}, error) { return Last(2, c) },
+		"limit 2":   func() ([]interface{}, error) { return Limit(2, c) },
+		"limit 2 3": func() ([]interface{}, error) { return Limit(2, 3, c) },
+		"reverse":   func() ([]interface{}, error) { return Reverse(c) },
+	} {
+		expected := map[string][]string{
+			"first 2":   {"A", "B"},
+			"first 9":   {"A"},
+			"last 2":    {"C", "D"},
+			"limit 2":   {"A", "B"},
+			"limit 2 3": {"D"},
+			"reverse":   {"D", "C", "B", "A"},
+		}[name]
+		items, err := f()
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if got := titles(items); !reflect.DeepEqual(expected, got) {
+			t.Errorf("%s: expected %v, got %v", name, expected, got)
+		}
+	}
+	if _, err := First(1, "not a collection"); err == nil {
+		t.Errorf("expected error for a string, got none")
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	sorted, _ := SortBy("date", "desc", testCollection())
+	groups, err := GroupBy("year", sorted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[interface{}][]string{}
+	keys := []interface{}{}
+	for _, g := range groups {
+		keys = append(keys, g.Key)
+		got[g.Key] = titles(g.Items)
+	}
+	if expected := []interface{}{"2014", "2013"}; !reflect.DeepEqual(expected, keys) {
+		t.Errorf("expected groups %v, got %v", expected, keys)
+	}
+	if expected := []string{"C", "A"}; !reflect.DeepEqual(expected, got["2013"]) {
+		t.Errorf("2013: expected %v, got %v", expected, got["2013"])
+	}
+
+	groups, err = GroupBy("k", []interface{}{
+		map[string]interface{}{"k": nil},
+		map[string]interface{}{"k": "a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].Key != "a" || len(groups[0].Items) != 1 {
+		t.Errorf("null key: expected one group a, got %v", groups)
+	}
+}
+
+func TestCollectionTemplate(t *testing.T) {
+	tmpl := template.Must(template.New("").Funcs(template.FuncMap{
+		"sortBy": SortBy,
+		"where":  Where,
+		"first":  First,
+	}).Parse(`{{ range first 2 (sortBy "date" "desc" (where "draft" "!=" true .)) }}{{ .title }}{{ end }}`))
+	buf := bytes.Buffer{}
+	if err := tmpl.Execute(&buf, testCollection()); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "BC", buf.String(); expected != got {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ConfigFiles are the names of the site configuration files looked for
+	// in the working directory, in order, if -config isn't given.
+	ConfigFiles = []string{"grender.json", "grender.yaml", "grender.yml"}
+
+	// ConfigPath is the absolute path of the site configuration file in use,
+	// if there is one. It's never treated as a source file.
+	ConfigPath = ""
+
+	// Markdown holds the site-wide options for rendering Markdown.
+	Markdown = MarkdownOptions{Smartypants: true, HeaderIDs: true}
+
+	// Environments are the names -env accepts, besides the environments in
+	// the site configuration file.
+	Environments = []string{"production", "staging", "dev"}
+)
+
+// Config is the site configuration, read from a configuration file like
+// grender.json or grender.yaml:
+//
+//	{
+//	  "source": "src",
+//	  "target": "public",
+//	  "globalKey": "files",
+//	  "baseURL": "https://example.com/",
+//	  "ignore": ["**/*.draft.md", "notes"],
+//	  "markdown": { "toc": true, "hardLineBreaks": true },
+//	  "site": { "title": "My Site" },
+//	  "environments": {
+//	    "dev": { "baseURL": "http://localhost:8000/", "drafts": true },
+//	    "production": { "site": { "analytics": "UA-12345" } }
+//	  }
+//	}
+//
+// The settings are defaults for the flags of the same names; flags given on
+// the command line win. Relative paths are relative to the file. Site
+// metadata is available to every page as "site".
+//
+// The settings of the environment chosen with -env are merged over the rest,
+// like metadata; its site metadata is kept apart, in EnvSite, so it can be
+// layered over the rest of the site metadata.
+type Config struct {
+	Source    string                 `json:"source"`
+	Target    string                 `json:"target"`
+	GlobalKey string                 `json:"globalKey"`
+	BaseURL   string                 `json:"baseURL"`
+	Ignore    []string               `json:"ignore"`
+	Drafts    *bool                  `json:"drafts"`
+	Future    *bool                  `json:"future"`
+	Expired   *bool                  `json:"expired"`
+	Markdown  MarkdownOptions        `json:"markdown"`
+	Site      map[string]interface{} `json:"site"`
+	EnvSite   map[string]interface{} `json:"-"`
+}
+
+// MarkdownOptions change how Markdown is rendered. A page can override TOC
+// with its "toc" key.
+type MarkdownOptions struct {
+	TOC            bool `json:"toc"`            // render a table of contents
+	Smartypants    bool `json:"smartypants"`    // typographic quotes and dashes
+	HeaderIDs      bool `json:"headerIDs"`      // give headers ids from their text
+	HardLineBreaks bool `json:"hardLineBreaks"` // newlines in paragraphs are <br>s
+}
+
+// ConfigFile returns the site configuration file named by -config or, if it
+// isn't given, the first of ConfigFiles in the working directory, if there
+// is one.
+func ConfigFile() string {
+	if *configFile != "" {
+		return *configFile
+	}
+	for _, name := range ConfigFiles {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// ParseConfig parses the site configuration in buf, from a file named
+// filename; YAML if it has a .yaml or .yml extension, and JSON otherwise,
+// for the environment env, if it isn't empty. Unknown settings are errors.
+// The Markdown options default to Markdown.
+func ParseConfig(filename string, buf []byte, env string) (Config, error) {
+	c := Config{Markdown: Markdown, Site: map[string]interface{}{}}
+	parse := parseDataJSON
+	switch filepath.Ext(filename) {
+	case ".yaml", ".yml":
+		parse = parseDataYAML
+	}
+	v, err := parse(buf)
+	if err != nil {
+		return c, err
+	}
+	settings, ok := v.(map[string]interface{})
+	if !ok {
+		return c, fmt.Errorf("must be a map of settings")
+	}
+
+	environments := map[string]interface{}{}
+	if declared, ok := settings["environments"]; ok {
+		if environments, ok = declared.(map[string]interface{}); !ok {
+			return c, fmt.Errorf("environments must be a map of names to settings")
+		}
+		delete(settings, "environments")
+	}
+	if env != "" {
+		overlay := map[string]interface{}{}
+		if declared, ok := environments[env]; ok {
+			if overlay, ok = declared.(map[string]interface{}); !ok {
+				return c, fmt.Errorf("environments: %s must be a map of settings", env)
+			}
+		} else if !StandardEnv(env) {
+			return c, fmt.Errorf("no environment %q", env)
+		}
+		if site, ok := overlay["site"]; ok {
+			if c.EnvSite, ok = site.(map[string]interface{}); !ok {
+				return c, fmt.Errorf("environments: %s: site must be a map", env)
+			}
+			delete(overlay, "site")
+		}
+		settings = MergeMetadata(settings, overlay)
+	}
+
+	if buf, err = json.Marshal(settings); err != nil {
+		return c, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&c); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// StandardEnv reports whether env is one of Environments, which -env accepts
+// even if the site configuration doesn't mention them.
+func StandardEnv(env string) bool {
+	for _, name := range Environments {
+		if env == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyConfig sets every flag in fs which wasn't given on the command line,
+// and has a setting in c, to the setting, and sets Markdown. dir is the
+// directory of the configuration file. An empty base URL or list of ignore
+// patterns is a setting, too, so an environment can clear them.
+func ApplyConfig(fs *flag.FlagSet, c Config, dir string) error {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, path := range []*string{&c.Source, &c.Target} {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+	settings := map[string]string{
+		"source":     c.Source,
+		"target":     c.Target,
+		"global.key": c.GlobalKey,
+		"base.url":   c.BaseURL,
+		"ignore":     strings.Join(c.Ignore, ","),
+	}
+	for name, value := range map[string]*bool{"drafts": c.Drafts, "future": c.Future, "expired": c.Expired} {
+		if value != nil {
+			settings[name] = fmt.Sprint(*value)
+		}
+	}
+	clearable := map[string]bool{"base.url": true, "ignore": true}
+	for name, value := range settings {
+		if value == "" && !clearable[name] || given[name] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	for _, pattern := range IgnorePatterns() {
+		if err := checkGlob(pattern); err != nil {
+			return fmt.Errorf("ignore: bad pattern %q: %s", pattern, err)
+		}
+	}
+	Markdown = c.Markdown
+	return nil
+}
+
+// SiteMetadata returns the metadata which every page gets from c: the site
+// metadata under the key "site", including the base URL, and the name of the
+// environment under the key "env". EnvSite isn't included; it's layered over
+// the rest with EnvMetadata.
+func SiteMetadata(c Config) map[string]interface{} {
+	site := MergeMetadata(map[string]interface{}{}, c.Site)
+	if *baseURL != "" {
+		site["baseURL"] = *baseURL
+	}
+	return map[string]interface{}{"site": site, "env": *env}
+}
+
+// EnvMetadata returns the metadata which every page gets from the site
+// metadata of c's environment, if it has any.
+func EnvMetadata(c Config) map[string]interface{} {
+	if len(c.EnvSite) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"site": c.EnvSite}
+}
+
+// IgnorePatterns returns the globs given by -ignore.
+func IgnorePatterns() []string {
+	patterns := []string{}
+	for _, pattern := range strings.Split(*ignore, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// Ignored reports whether path, in the source directory, matches any of the
+// IgnorePatterns (see MatchGlob), relative to the source directory, or is the
+// site configuration file. Walks over the source directory skip it.
+func Ignored(path string) bool {
+	if path == *sourceDir || !strings.HasPrefix(path, *sourceDir+string(filepath.Separator)) {
+		return false
+	}
+	if path == ConfigPath {
+		return true
+	}
+	name := filepath.ToSlash(Relative(*sourceDir, path))
+	for _, pattern := range IgnorePatterns() {
+		if ok, _ := MatchGlob(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// skip returns what a WalkFunc returns to skip the file described by info.
+func skip(info os.FileInfo) error {
+	if info.IsDir() {
+		return filepath.SkipDir
+	}
+	return nil
+}
+
+// AbsURL makes the URL u absolute with the base URL, if there is one, and u
+// is a path. It's exposed to templates as "absURL".
+func AbsURL(u string) string {
+	if *baseURL == "" || strings.Contains(u, "://") || strings.HasPrefix(u, "//") {
+		return u
+	}
+	return strings.TrimSuffix(*baseURL, "/") + "/" + strings.TrimPrefix(u, "/")
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	expected := Config{
+		Source:   "site",
+		BaseURL:  "https://example.com/",
+		Ignore:   []string{"notes", "**/*.draft.md"},
+		Markdown: MarkdownOptions{TOC: true, Smartypants: true, HeaderIDs: true},
+		Site:     map[string]interface{}{"title": "Example", "authors": []interface{}{"Jane"}},
+	}
+	for filename, buf := range map[string]string{
+		"grender.json": `{
+			"source": "site",
+			"baseURL": "https://example.com/",
+			"ignore": ["notes", "**/*.draft.md"],
+			"markdown": {"toc": true},
+			"site": {"title": "Example", "authors": ["Jane"]}
+		}`,
+		"grender.yaml": "source: site\nbaseURL: https://example.com/\nignore:\n  - notes\n  - \"**/*.draft.md\"\nmarkdown:\n  toc: true\nsite:\n  title: Example\n  authors: [Jane]\n",
+	} {
+		got, err := ParseConfig(filename, []byte(buf), "")
+		if err != nil {
+			t.Errorf("%s: %s", filename, err)
+			continue
+		}
+		if !reflect.DeepEqual(expected, got) {
+			t.Errorf("%s: expected\n%v\ngot\n%v", filename, expected, got)
+		}
+	}
+
+	if _, err := ParseConfig("grender.json", []byte(`{"sorce": "site"}`), ""); err == nil {
+		t.Errorf("expected an error for an unknown setting")
+	}
+}
+
+func TestParseConfigEnvironments(t *testing.T) {
+	buf := []byte(`{
+		"baseURL": "https://example.com/",
+		"markdown": {"toc": true},
+		"site": {"title": "Example", "analytics": ""},
+		"environments": {
+			"dev": {"baseURL": "http://localhost:8000/", "drafts": true, "markdown": {"smartypants": false}},
+			"production": {"site": {"analytics": "UA-12345"}},
+			"preview": {"future": true},
+			"local": {"baseURL": {"$remove": true}, "ignore": []}
+		}
+	}`)
+	drafts, future := true, true
+	for env, expected := range map[string]Config{
+		"": {
+			BaseURL:  "https://example.com/",
+			Markdown: MarkdownOptions{TOC: true, Smartypants: true, HeaderIDs: true},
+		},
+		"dev": {
+			BaseURL:  "http://localhost:8000/",
+			Drafts:   &drafts,
+			Markdown: MarkdownOptions{TOC: true, HeaderIDs: true},
+		},
+		"production": {
+			BaseURL:  "https://example.com/",
+			Markdown: MarkdownOptions{TOC: true, Smartypants: true, HeaderIDs: true},
+			EnvSite:  map[string]interface{}{"analytics": "UA-12345"},
+		},
+		"staging": {
+			BaseURL:  "https://example.com/",
+			Markdown: MarkdownOptions{TOC: true, Smartypants: true, HeaderIDs: true},
+		},
+		"preview": {
+			BaseURL:  "https://example.com/",
+			Future:   &future,
+			Markdown: MarkdownOptions{TOC: true, Smartypants: true, HeaderIDs: true},
+		},
+		"local": {
+			Ignore:   []string{},
+			Markdown: MarkdownOptions{TOC: true, Smartypants: true, HeaderIDs: true},
+		},
+	} {
+		expected.Site = map[string]interface{}{"title": "Example", "analytics": ""}
+		got, err := ParseConfig("grender.json", buf, env)
+		if err != nil {
+			t.Errorf("%q: %s", env, err)
+			continue
+		}
+		if !reflect.DeepEqual(expected, got) {
+			t.Errorf("%q: expected\n%+v\ngot\n%+v", env, expected, got)
+		}
+	}
+
+	if _, err := ParseConfig("grender.json", buf, "prod"); err == nil {
+		t.Errorf("expected an error for an unknown environment")
+	}
+	if _, err := ParseConfig("grender.json", []byte(`{"environments": {"dev": {"draft": true}}}`), "dev"); err == nil {
+		t.Errorf("expected an error for an unknown setting in an environment")
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	defer func(src, tgt, key, url, ign string, md MarkdownOptions, d bool) {
+		*sourceDir, *targetDir, *globalKey, *baseURL, *ignore, Markdown, *drafts = src, tgt, key, url, ign, md, d
+	}(*sourceDir, *targetDir, *globalKey, *baseURL, *ignore, Markdown, *drafts)
+
+	// The flags ApplyConfig sets, as if -target were given on the command
+	// line.
+	*baseURL = "http://stale.example.com/" // cleared by the empty setting
+	fs := flag.NewFlagSet("grender", flag.ContinueOnError)
+	for name, value := range map[string]*string{
+		"source":     sourceDir,
+		"target":     targetDir,
+		"global.key": globalKey,
+		"base.url":   baseURL,
+		"ignore":     ignore,
+	} {
+		fs.StringVar(value, name, *value, "")
+	}
+	fs.BoolVar(drafts, "drafts", *drafts, "")
+	if err := fs.Parse([]string{"-target", "/given"}); err != nil {
+		t.Fatal(err)
+	}
+	config := Config{
+		Source:    "site",
+		Target:    "public",
+		GlobalKey: "pages",
+		Ignore:    []string{"notes", "*.draft.md"},
+		Markdown:  MarkdownOptions{HardLineBreaks: true},
+	}
+	config.Drafts = new(bool)
+	*config.Drafts = true
+	if err := ApplyConfig(fs, config, "/project"); err != nil {
+		t.Fatal(err)
+	}
+	for name, tuple := range map[string][2]string{
+		"source":     {filepath.FromSlash("/project/site"), *sourceDir},
+		"target":     {"/given", *targetDir},
+		"global.key": {"pages", *globalKey},
+		"ignore":     {"notes,*.draft.md", *ignore},
+		"base.url":   {"", *baseURL},
+	} {
+		if tuple[0] != tuple[1] {
+			t.Errorf("%s: expected %s, got %s", name, tuple[0], tuple[1])
+		}
+	}
+	if !*drafts {
+		t.Errorf("drafts wasn't set")
+	}
+	if !Markdown.HardLineBreaks || Markdown.Smartypants {
+		t.Errorf("Markdown options weren't set: %+v", Markdown)
+	}
+
+	defer func(path string) { ConfigPath = path }(ConfigPath)
+	*sourceDir, ConfigPath = "/project/site", filepath.FromSlash("/project/site/grender.yaml")
+	for path, expected := range map[string]bool{
+		"/project/site/grender.yaml":      true,
+		"/project/site/blog/grender.yaml": false,
+		"/project/site":                   false,
+		"/project/site/index.html":        false,
+		"/project/site/notes":             true,
+		"/project/site/blog/notes":        true,
+		"/project/site/blog/a.draft.md":   true,
+		"/project/site/blog/a.md":         false,
+		"/project/elsewhere/a.draft.md":   false,
+		"/project/site/blog/notes.md":     false,
+		"/project/site/notes/anything.md": false, // skipped with its directory
+	} {
+		if got := Ignored(filepath.FromSlash(path)); got != expected {
+			t.Errorf("Ignored(%s): expected %v, got %v", path, expected, got)
+		}
+	}
+
+	*ignore = "a/["
+	if err := ApplyConfig(fs, config, "/project"); err == nil {
+		t.Errorf("expected an error for a bad ignore pattern")
+	}
+}
+
+func TestAbsURL(t *testing.T) {
+	defer func(url string) { *baseURL = url }(*baseURL)
+	for _, tuple := range []struct{ base, u, expected string }{
+		{"", "/a/b.html", "/a/b.html"},
+		{"https://example.com", "/a/b.html", "https://example.com/a/b.html"},
+		{"https://example.com/blog/", "a/", "https://example.com/blog/a/"},
+		{"https://example.com", "http://other.com/", "http://other.com/"},
+		{"https://example.com", "//cdn.example.com/x.js", "//cdn.example.com/x.js"},
+	} {
+		*baseURL = tuple.base
+		if got := AbsURL(tuple.u); got != tuple.expected {
+			t.Errorf("%s + %s: expected %s, got %s", tuple.base, tuple.u, tuple.expected, got)
+		}
+	}
+}
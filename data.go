@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/peterbourgon/mergemap"
+	"gopkg.in/yaml.v3"
+)
+
+// DataParsers map the extensions of data files to the function which parses
+// them.
+var DataParsers = map[string]func([]byte) (interface{}, error){
+	".json": parseDataJSON,
+	".yaml": parseDataYAML,
+	".yml":  parseDataYAML,
+	".toml": parseDataTOML,
+	".csv":  parseDataCSV,
+}
+
+// DataDir returns the absolute path of the data directory.
+func DataDir() string {
+	return filepath.Join(*sourceDir, *dataDir)
+}
+
+// IsDataDir reports whether path is the data directory. Walks over the source
+// directory skip it: data files aren't metadata, and aren't copied.
+func IsDataDir(path string) bool {
+	return *dataDir != "" && filepath.Clean(path) == DataDir()
+}
+
+// Data holds the contents of every data file, as LoadData returns them.
+// With -data, RenderTemplate gives it to every template as "data", beside the
+// metadata of the page rather than in it; "data" is reserved, so no metadata
+// may set it.
+var Data = map[string]interface{}{}
+
+// CheckDataKey fatals if metadata, from name, sets the key "data", which is
+// reserved if there's a data directory.
+func CheckDataKey(name string, metadata map[string]interface{}) {
+	if _, ok := metadata["data"]; ok && *dataDir != "" {
+		Fatalf("%s: data is reserved for data files", name)
+	}
+}
+
+// LoadData parses every data file beneath the data directory, and returns
+// their contents in a map structured by their paths, without extensions. As
+// an example, data/authors/jane.yaml is available as m["authors"]["jane"].
+func LoadData() map[string]interface{} {
+	m := map[string]interface{}{}
+	if *dataDir == "" {
+		return m
+	}
+	if _, err := os.Stat(DataDir()); os.IsNotExist(err) {
+		return m
+	}
+	filepath.Walk(DataDir(), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			Fatalf("load data: %s", err)
+		}
+		if info.IsDir() || strings.HasPrefix(filepath.Base(path), ".") {
+			return nil
+		}
+		parse, ok := DataParsers[strings.ToLower(filepath.Ext(path))]
+		switch {
+		case !ok && (filepath.Ext(path) == ".html" || filepath.Ext(path) == ".md"):
+			Warningf("%s: pages in the data directory aren't rendered; ignoring", path)
+			return nil
+		case !ok:
+			Warningf("%s: unknown data file type; ignoring", path)
+			return nil
+		}
+		v, err := parse(Read(path))
+		if err != nil {
+			Fatalf("%s: %s", path, err)
+		}
+		rel := Relative(DataDir(), path)
+		if err := setPath(m, SplitPath(rel[:len(rel)-len(filepath.Ext(rel))]), v); err != nil {
+			Fatalf("%s: %s", path, err)
+		}
+		Debugf("%s loaded as data", path)
+		return nil
+	})
+	return m
+}
+
+// setPath sets m[path[0]][path[1]]...[path[n]] to v, creating intermediate
+// maps as necessary. If there's already a map there, and v is a map, too,
+// they're merged.
+func setPath(m map[string]interface{}, path []string, v interface{}) error {
+	for i, key := range path {
+		if i == len(path)-1 {
+			existing, ok := m[key]
+			if !ok {
+				m[key] = v
+				return nil
+			}
+			existingMap, ok1 := existing.(map[string]interface{})
+			vMap, ok2 := v.(map[string]interface{})
+			if !ok1 || !ok2 {
+				return fmt.Errorf("%s is defined twice", strings.Join(path, "."))
+			}
+			m[key] = mergemap.Merge(existingMap, vMap)
+			return nil
+		}
+		if _, ok := m[key]; !ok {
+			m[key] = map[string]interface{}{}
+		}
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is defined twice", strings.Join(path[:i+1], "."))
+		}
+		m = next
+	}
+	return nil
+}
+
+func parseDataJSON(buf []byte) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal(buf, &v)
+	return v, err
+}
+
+func parseDataYAML(buf []byte) (interface{}, error) {
+	var v interface{}
+	err := yaml.Unmarshal(buf, &v)
+	return v, err
+}
+
+func parseDataTOML(buf []byte) (interface{}, error) {
+	m := map[string]interface{}{}
+	_, err := toml.Decode(string(buf), &m)
+	return m, err
+}
+
+// parseDataCSV parses CSV with a header row into a list of records, each of
+// which maps column names to values.
+func parseDataCSV(buf []byte) (interface{}, error) {
+	rows, err := csv.NewReader(bytes.NewReader(buf)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	records := []interface{}{}
+	if len(rows) == 0 {
+		return records, nil
+	}
+	header := rows[0]
+	for _, row := range rows[1:] {
+		record := map[string]interface{}{}
+		for i, column := range header {
+			record[column] = row[i]
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
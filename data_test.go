@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadData(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "grender-test-data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(src, data string) { *sourceDir, *dataDir = src, data }(*sourceDir, *dataDir)
+	*sourceDir, *dataDir = dir, "data"
+
+	Write(filepath.Join(dir, "data", "site.json"), []byte(`{"title": "Site"}`))
+	Write(filepath.Join(dir, "data", "authors", "jane.yaml"), []byte("name: Jane\nlinks:\n  - a\n  - b\n"))
+	Write(filepath.Join(dir, "data", "authors", "joe.toml"), []byte(`name = "Joe"`))
+	Write(filepath.Join(dir, "data", "events.csv"), []byte("name,year\nLaunch,2013\nParty,2014\n"))
+
+	expected := map[string]interface{}{
+		"site": map[string]interface{}{"title": "Site"},
+		"authors": map[string]interface{}{
+			"jane": map[string]interface{}{"name": "Jane", "links": []interface{}{"a", "b"}},
+			"joe":  map[string]interface{}{"name": "Joe"},
+		},
+		"events": []interface{}{
+			map[string]interface{}{"name": "Launch", "year": "2013"},
+			map[string]interface{}{"name": "Party", "year": "2014"},
+		},
+	}
+	if got := LoadData(); !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected\n%#v\ngot\n%#v", expected, got)
+	}
+	if !IsDataDir(filepath.Join(dir, "data")) || IsDataDir(filepath.Join(dir, "data", "authors")) {
+		t.Errorf("IsDataDir is wrong")
+	}
+}
+
+func TestSetPath(t *testing.T) {
+	m := map[string]interface{}{}
+	if err := setPath(m, []string{"a", "b"}, map[string]interface{}{"x": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := setPath(m, []string{"a", "b"}, map[string]interface{}{"y": 2}); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"a": map[string]interface{}{"b": map[string]interface{}{"x": 1, "y": 2}}}
+	if !reflect.DeepEqual(expected, m) {
+		t.Errorf("expected %v, got %v", expected, m)
+	}
+	if err := setPath(m, []string{"a", "b"}, []interface{}{}); err == nil {
+		t.Errorf("expected error redefining a.b, got none")
+	}
+	if err := setPath(m, []string{"a", "b", "x", "z"}, 3); err == nil {
+		t.Errorf("expected error descending into a.b.x, got none")
+	}
+}
+
+func TestRenderTemplateData(t *testing.T) {
+	defer func(data map[string]interface{}, dir string) { Data, *dataDir = data, dir }(Data, *dataDir)
+	Data, *dataDir = map[string]interface{}{"authors": map[string]interface{}{"jane": "Jane"}}, "data"
+	metadata := map[string]interface{}{"title": "Hello"}
+	got := string(RenderTemplate(filepath.Join(*sourceDir, "x.txt"), []byte("{{ .title }} by {{ .data.authors.jane }}"), metadata))
+	if expected := "Hello by Jane"; expected != got {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if _, ok := metadata["data"]; ok {
+		t.Errorf("data was added to the page's metadata")
+	}
+
+	// Without a data directory, data is an ordinary key.
+	*dataDir = ""
+	metadata["data"] = "mine"
+	got = string(RenderTemplate(filepath.Join(*sourceDir, "x.txt"), []byte("{{ .data }}"), metadata))
+	if expected := "mine"; expected != got {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
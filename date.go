@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	// DateLayouts are tried, in order, when parsing dates from metadata.
+	// Layouts without an explicit offset are interpreted in DateLocation.
+	DateLayouts = []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+		"2006-01-02",
+		"2006 01 02", // the legacy BlogTuple.DateString format
+	}
+
+	// DateLocation is the time zone used for dates that don't specify one,
+	// including dates derived from blog entry filenames.
+	DateLocation = time.Local
+)
+
+// DateKeys are the metadata keys which are parsed into time.Time values.
+var DateKeys = []string{"date", "publishDate", "expiryDate"}
+
+// ParseDate parses the passed string using the first matching DateLayout.
+func ParseDate(s string) (time.Time, error) {
+	for _, layout := range DateLayouts {
+		if t, err := time.ParseInLocation(layout, s, DateLocation); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q doesn't match any known date layout", s)
+}
+
+// ToDate converts the passed metadata value to a time.Time, if possible.
+func ToDate(i interface{}) (time.Time, bool) {
+	switch v := i.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		t, err := ParseDate(v)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// NormalizeDates replaces every DateKey in the metadata with its parsed
+// time.Time value, and fatals if any of them can't be parsed.
+func NormalizeDates(path string, metadata map[string]interface{}) {
+	for _, key := range DateKeys {
+		v, ok := metadata[key]
+		if !ok {
+			continue
+		}
+		t, ok := ToDate(v)
+		if !ok {
+			Fatalf("%s: bad %s %v", path, key, v)
+		}
+		metadata[key] = t
+	}
+}
+
+// FormatDate formats the passed date (a time.Time or a parseable string)
+// according to layout. It's exposed to templates as "date".
+func FormatDate(layout string, i interface{}) (string, error) {
+	t, ok := ToDate(i)
+	if !ok {
+		return "", fmt.Errorf("date: can't use %v as a date", i)
+	}
+	return t.Format(layout), nil
+}
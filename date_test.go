@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	defer func(loc *time.Location) { DateLocation = loc }(DateLocation)
+	DateLocation = time.UTC
+
+	for s, expected := range map[string]time.Time{
+		"2013-03-04":                time.Date(2013, 3, 4, 0, 0, 0, 0, time.UTC),
+		"2013 03 04":                time.Date(2013, 3, 4, 0, 0, 0, 0, time.UTC),
+		"2013-03-04 15:16":          time.Date(2013, 3, 4, 15, 16, 0, 0, time.UTC),
+		"2013-03-04T15:16:17":       time.Date(2013, 3, 4, 15, 16, 17, 0, time.UTC),
+		"2013-03-04T15:16:17+02:00": time.Date(2013, 3, 4, 13, 16, 17, 0, time.UTC),
+	} {
+		got, err := ParseDate(s)
+		if err != nil {
+			t.Errorf("%q: %s", s, err)
+			continue
+		}
+		if !expected.Equal(got) {
+			t.Errorf("%q: expected %s, got %s", s, expected, got)
+		}
+	}
+
+	for _, s := range []string{"", "yesterday", "2013/03/04"} {
+		if _, err := ParseDate(s); err == nil {
+			t.Errorf("%q: expected error, got none", s)
+		}
+	}
+}
+
+func TestBlogTupleDate(t *testing.T) {
+	defer func(loc *time.Location) { DateLocation = loc }(DateLocation)
+	DateLocation = time.FixedZone("X", 3600)
+
+	bt, ok := NewBlogTuple("/foo/2013-1-2-foo_bar-baz.md", ".html")
+	if !ok {
+		t.Fatal("NewBlogTuple failed")
+	}
+	expected := time.Date(2013, 1, 2, 0, 0, 0, 0, DateLocation)
+	if got := bt.Date(); !expected.Equal(got) {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	for i, expected := range map[interface{}]string{
+		time.Date(2013, 3, 4, 0, 0, 0, 0, time.UTC): "Mar 4, 2013",
+		"2013-03-04": "Mar 4, 2013",
+	} {
+		got, err := FormatDate("Jan 2, 2006", i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected != got {
+			t.Errorf("%v: expected %q, got %q", i, expected, got)
+		}
+	}
+
+	if _, err := FormatDate("Jan 2, 2006", 123); err == nil {
+		t.Errorf("expected error, got none")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// DumpMetadata writes the metadata Get returns for path to w, one key per
+// line, after the Stack layers which set or changed it; the last one won. The
+// Global Key is summarized, rather than written out in full.
+func DumpMetadata(w io.Writer, s *Stack, path string) {
+	provenance := s.Provenance(path)
+	layers := []string{}
+	for _, layer := range s.Layers(path) {
+		layers = append(layers, LayerName(layer))
+	}
+	fmt.Fprintf(w, "# %s, layered from %s\n", LayerName(StackKey(path)), strings.Join(layers, ", "))
+
+	keys := []string{}
+	for k := range provenance {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, k := range keys {
+		p, value := provenance[k], ""
+		if m, ok := p.Value.(map[string]interface{}); ok && k == *globalKey {
+			value = fmt.Sprintf("{%d element(s)}", len(m))
+		} else if buf, err := json.Marshal(p.Value); err == nil {
+			value = string(buf)
+		} else {
+			value = fmt.Sprint(p.Value)
+		}
+		names := []string{}
+		for _, layer := range p.Layers {
+			names = append(names, LayerName(layer))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", k, strings.Join(names, " > "), value)
+	}
+	tw.Flush()
+}
+
+// ConsultedLayers names the Stack layers Get consults for path, which may
+// hold metadata: global metadata, the source directory, and everything
+// beneath it along the way to path.
+func ConsultedLayers(path string) []string {
+	source := StackKey(*sourceDir)
+	names := []string{}
+	for _, key := range StackPaths(path) {
+		if key == "" || key == source || strings.HasPrefix(key, source+string(filepath.Separator)) {
+			names = append(names, LayerName(key))
+		}
+	}
+	return names
+}
+
+// LayerName describes the Stack layer key for people: "(global)", or its
+// path relative to the source directory.
+func LayerName(key string) string {
+	source := StackKey(*sourceDir)
+	switch {
+	case key == "":
+		return "(global)"
+	case key == source:
+		return "(source directory)"
+	case strings.HasPrefix(key, source+string(filepath.Separator)):
+		return filepath.ToSlash(key[len(source)+1:])
+	}
+	return key
+}
+
+// DumpPath resolves the -dump-metadata argument name to a path in the Stack:
+// a source file, relative to the working directory or the source directory,
+// or a page generated from one, like blog/events.html/03.
+func DumpPath(s *Stack, name string) string {
+	candidates := []string{filepath.Join(*sourceDir, name)}
+	if abs, err := filepath.Abs(name); err == nil {
+		candidates = append([]string{abs}, candidates...)
+	}
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil || s.Layer(StackKey(path)) != nil {
+			return path
+		}
+	}
+	Fatalf("-dump-metadata: %s isn't a source file", name)
+	return ""
+}
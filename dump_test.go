@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDumpMetadata(t *testing.T) {
+	path := filepath.Join(*sourceDir, "blog", "entry.md")
+	s := NewStack()
+	s.Add(filepath.Join(*sourceDir, "blog"), map[string]interface{}{"template": "entry.template", "author": "jane"})
+	s.Add(path, map[string]interface{}{"template": "entry.template", "author": "joe", "title": "Entry"})
+	s.Add("", map[string]interface{}{*globalKey: map[string]interface{}{"blog": nil}})
+
+	buf := bytes.Buffer{}
+	DumpMetadata(&buf, s, path)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	for i, expected := range []string{
+		"# blog/entry.md, layered from (global), blog, blog/entry.md",
+		"author    blog > blog/entry.md  \"joe\"",
+		*globalKey + "     (global)              {1 element(s)}",
+		"template  blog                  \"entry.template\"",
+		"title     blog/entry.md         \"Entry\"",
+	} {
+		if i >= len(lines) || lines[i] != expected {
+			t.Errorf("expected line %d to be %q, got\n%s", i, expected, buf.String())
+			break
+		}
+	}
+}
+
+func TestConsultedLayers(t *testing.T) {
+	path := filepath.Join(*sourceDir, "a", "b.md")
+	if expected, got := []string{"(global)", "(source directory)", "a", "a/b.md"}, ConsultedLayers(path); !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template/parse"
+)
+
+// Escapers map the name of an escaper to the template function which
+// implements it. Templates whose output isn't HTML are rendered with
+// text/template, and every action's output is piped through the escaper
+// for the output type, if there is one.
+var Escapers = map[string]interface{}{
+	"xml":  XMLEscape,
+	"json": JSONEscape,
+}
+
+// RawText is exempt from escaping by XMLEscape and JSONEscape. Templates
+// produce it with the raw function.
+type RawText string
+
+// TemplateEscaper returns how values are escaped in the output of the
+// template at path: "html" (by html/template), "xml", "json", or "" for not
+// at all. The output type is determined by the extension, ignoring a .tmpl or
+// .source suffix. Files other than .tmpl files are HTML, unless their
+// extension says otherwise.
+func TemplateEscaper(path string) string {
+	templated := strings.HasSuffix(path, ".tmpl")
+	for _, suffix := range []string{".tmpl", ".source"} {
+		path = strings.TrimSuffix(path, suffix)
+	}
+	switch filepath.Ext(path) {
+	case ".html", ".htm":
+		return "html"
+	case ".xml", ".rss", ".atom", ".svg":
+		return "xml"
+	case ".json", ".webmanifest":
+		return "json"
+	case ".css", ".js", ".txt":
+		return ""
+	}
+	if templated {
+		return ""
+	}
+	return "html"
+}
+
+// XMLEscape escapes its arguments for XML text and attribute values.
+func XMLEscape(args ...interface{}) string {
+	s, raw := printArgs(args)
+	if raw {
+		return s
+	}
+	buf := bytes.Buffer{}
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// JSONEscape escapes its arguments for the inside of a JSON string.
+func JSONEscape(args ...interface{}) string {
+	s, raw := printArgs(args)
+	if raw {
+		return s
+	}
+	buf, _ := json.Marshal(s)
+	return string(buf[1 : len(buf)-1])
+}
+
+func printArgs(args []interface{}) (string, bool) {
+	if len(args) == 1 {
+		if raw, ok := args[0].(RawText); ok {
+			return string(raw), true
+		}
+	}
+	return fmt.Sprint(args...), false
+}
+
+// escapeActions appends the escaper function to the pipeline of every action
+// beneath node, which prints a value, in the template tree t.
+func escapeActions(t *parse.Tree, node parse.Node, escaper string) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			escapeActions(t, child, escaper)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 {
+			return // {{ $x := ... }} prints nothing
+		}
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{parse.NewIdentifier(escaper).SetTree(t).SetPos(n.Pos)},
+		})
+	case *parse.IfNode:
+		escapeActions(t, n.List, escaper)
+		escapeActions(t, n.ElseList, escaper)
+	case *parse.RangeNode:
+		escapeActions(t, n.List, escaper)
+		escapeActions(t, n.ElseList, escaper)
+	case *parse.WithNode:
+		escapeActions(t, n.List, escaper)
+		escapeActions(t, n.ElseList, escaper)
+	}
+}
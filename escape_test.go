@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"text/template"
+)
+
+func TestEscapeActions(t *testing.T) {
+	data := map[string]interface{}{
+		"title": `Tom & "Jerry" <3`,
+		"list":  []string{"a<b", "c"},
+	}
+	for escaper, expected := range map[string]string{
+		"xml":  `<t>Tom &amp; &#34;Jerry&#34; &lt;3</t><i>a&lt;b</i><i>c</i><r><b/></r>`,
+		"json": `<t>Tom \u0026 \"Jerry\" \u003c3</t><i>a\u003cb</i><i>c</i><r><b/></r>`,
+	} {
+		funcs := template.FuncMap{"raw": func(s interface{}) RawText { return RawText(s.(string)) }}
+		for name, f := range Escapers {
+			funcs[name] = f
+		}
+		tmpl, err := template.New("test").Funcs(funcs).Parse(
+			`<t>{{ .title }}</t>{{ range .list }}<i>{{ . }}</i>{{ end }}{{ $x := "<b/>" }}<r>{{ raw $x }}</r>`,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		escapeActions(tmpl.Tree, tmpl.Tree.Root, escaper)
+
+		buf := bytes.Buffer{}
+		if err := tmpl.Execute(&buf, data); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); expected != got {
+			t.Errorf("%s: expected\n%s\ngot\n%s", escaper, expected, got)
+		}
+	}
+}
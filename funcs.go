@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TemplateFuncs are the template functions which don't depend on the file
+// being rendered. RenderTemplate adds the ones that do.
+var TemplateFuncs = template.FuncMap{
+	"title":         Title,
+	"lower":         strings.ToLower,
+	"upper":         strings.ToUpper,
+	"trim":          strings.TrimSpace,
+	"truncateWords": TruncateWords,
+	"markdownify":   Markdownify,
+	"jsonify":       Jsonify,
+	"safeHTML":      func(s string) template.HTML { return template.HTML(s) },
+	"absURL":        AbsURL,
+	"dict":          Dict,
+	"list":          func(args ...interface{}) []interface{} { return args },
+	"default":       Default,
+	"add":           func(a, b interface{}) (interface{}, error) { return arithmetic("add", a, b) },
+	"sub":           func(a, b interface{}) (interface{}, error) { return arithmetic("sub", a, b) },
+	"mul":           func(a, b interface{}) (interface{}, error) { return arithmetic("mul", a, b) },
+	"div":           func(a, b interface{}) (interface{}, error) { return arithmetic("div", a, b) },
+	"mod":           func(a, b interface{}) (interface{}, error) { return arithmetic("mod", a, b) },
+}
+
+// Title capitalizes the first letter of every word in s.
+func Title(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		start := !unicode.IsLetter(prev) && !unicode.IsDigit(prev) && prev != '\'' && prev != '’'
+		prev = r
+		if start {
+			return unicode.ToTitle(r)
+		}
+		return r
+	}, s)
+}
+
+// TruncateWords returns the first n words of s, followed by an ellipsis if
+// there were more.
+func TruncateWords(n int, s string) string {
+	words := strings.Fields(s)
+	if len(words) <= n {
+		return strings.Join(words, " ")
+	}
+	return strings.Join(words[:n], " ") + "…"
+}
+
+// Markdownify renders s as Markdown. If it's a single paragraph, such as a
+// title or a summary from metadata, the enclosing <p> element is removed.
+func Markdownify(s string) template.HTML {
+	buf, _ := RenderMarkdown([]byte(s), 0, 0, nil)
+	buf = bytes.TrimSpace(buf)
+	if inner := bytes.TrimSuffix(bytes.TrimPrefix(buf, []byte("<p>")), []byte("</p>")); len(inner) == len(buf)-7 && !bytes.Contains(inner, []byte("<p>")) {
+		buf = inner
+	}
+	return template.HTML(buf)
+}
+
+// Jsonify encodes v as JSON. The result is safe to use in a <script>.
+func Jsonify(v interface{}) (template.JS, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("jsonify: %s", err)
+	}
+	return template.JS(buf), nil
+}
+
+// Dict builds a map from alternating keys and values, such as to pass several
+// values to a template: {{ template "card" dict "title" .title "url" .url }}.
+func Dict(args ...interface{}) (map[string]interface{}, error) {
+	if len(args)%2 != 0 {
+		return nil, fmt.Errorf("dict: expected pairs of keys and values")
+	}
+	m := map[string]interface{}{}
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key %v isn't a string", args[i])
+		}
+		m[key] = args[i+1]
+	}
+	return m, nil
+}
+
+// Default returns given, unless it's missing or empty (false, 0, "", or an
+// empty list or map), in which case it returns def. It's meant for pipelines:
+// {{ .title | default "Untitled" }}.
+func Default(def interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || given[0] == nil {
+		return def
+	}
+	v := reflect.ValueOf(given[0])
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		if v.Len() == 0 {
+			return def
+		}
+	default:
+		if v.IsZero() {
+			return def
+		}
+	}
+	return given[0]
+}
+
+// arithmetic applies op to two numbers. The result is an int if both are
+// whole numbers, and a float64 otherwise; mod only takes whole numbers.
+func arithmetic(op string, a, b interface{}) (interface{}, error) {
+	x, ok := number(a)
+	if !ok {
+		return nil, fmt.Errorf("%s: %v isn't a number", op, a)
+	}
+	y, ok := number(b)
+	if !ok {
+		return nil, fmt.Errorf("%s: %v isn't a number", op, b)
+	}
+	whole := x == float64(int(x)) && y == float64(int(y))
+	if (op == "div" || op == "mod") && y == 0 {
+		return nil, fmt.Errorf("%s: division by zero", op)
+	}
+	var result float64
+	switch op {
+	case "add":
+		result = x + y
+	case "sub":
+		result = x - y
+	case "mul":
+		result = x * y
+	case "div":
+		if whole && int(x)%int(y) == 0 {
+			return int(x) / int(y), nil
+		}
+		return x / y, nil
+	case "mod":
+		if !whole {
+			return nil, fmt.Errorf("mod: %v and %v must be whole numbers", a, b)
+		}
+		return int(x) % int(y), nil
+	}
+	if whole {
+		return int(result), nil
+	}
+	return result, nil
+}
+
+// ReadFile returns the contents of the file name, relative to the file at
+// path, or to the source directory if it begins with "/". Unlike the import
+// functions, it doesn't render them as a template. Files outside of the source
+// directory can't be read.
+func ReadFile(path, name string) (string, error) {
+	filename := filepath.Join(filepath.Dir(path), filepath.FromSlash(name))
+	if strings.HasPrefix(name, "/") {
+		filename = filepath.Join(*sourceDir, filepath.FromSlash(name))
+	}
+	if !strings.HasPrefix(filename, *sourceDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("readFile: %s is outside of the source directory", name)
+	}
+	if info, err := os.Stat(filename); err != nil || info.IsDir() {
+		return "", fmt.Errorf("readFile: %s doesn't exist", name)
+	}
+	buf := Read(filename)
+	if !utf8.Valid(buf) {
+		return "", fmt.Errorf("readFile: %s isn't text", name)
+	}
+	return string(buf), nil
+}
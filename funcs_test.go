@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStrings(t *testing.T) {
+	for got, expected := range map[string]string{
+		Title("the go-to guide, vol. 2"):        "The Go-To Guide, Vol. 2",
+		Title("don't panic"):                    "Don't Panic",
+		TruncateWords(3, "one two  three four"): "one two three…",
+		TruncateWords(5, " one two "):           "one two",
+		string(Markdownify("*Hello*, world")):   "<em>Hello</em>, world",
+		string(Markdownify("one\n\ntwo")):       "<p>one</p>\n\n<p>two</p>",
+	} {
+		if expected != got {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	}
+}
+
+func TestDictAndDefault(t *testing.T) {
+	m, err := Dict("a", 1, "b", "two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]interface{}{"a": 1, "b": "two"}; !reflect.DeepEqual(expected, m) {
+		t.Errorf("expected %v, got %v", expected, m)
+	}
+	for _, args := range [][]interface{}{{"a"}, {1, 2}} {
+		if _, err := Dict(args...); err == nil {
+			t.Errorf("%v: expected error, got none", args)
+		}
+	}
+
+	for _, given := range [][]interface{}{{}, {nil}, {""}, {0.0}, {false}, {[]interface{}{}}} {
+		if got := Default("x", given...); got != "x" {
+			t.Errorf("%v: expected default, got %v", given, got)
+		}
+	}
+	for _, given := range []interface{}{"y", 1.5, true, time.Now()} {
+		if got := Default("x", given); got != given {
+			t.Errorf("%v: expected it, got %v", given, got)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	for _, tuple := range []struct {
+		op       string
+		a, b     interface{}
+		expected interface{}
+	}{
+		{"add", 1, 2.0, 3},
+		{"add", 1, 0.5, 1.5},
+		{"sub", 10.0, 4, 6},
+		{"mul", 3, 4, 12},
+		{"div", 12, 4, 3},
+		{"div", 1, 4, 0.25},
+		{"mod", 13, 4.0, 1},
+	} {
+		got, err := arithmetic(tuple.op, tuple.a, tuple.b)
+		if err != nil {
+			t.Errorf("%s %v %v: %s", tuple.op, tuple.a, tuple.b, err)
+			continue
+		}
+		if tuple.expected != got {
+			t.Errorf("%s %v %v: expected %v (%T), got %v (%T)", tuple.op, tuple.a, tuple.b, tuple.expected, tuple.expected, got, got)
+		}
+	}
+	for _, args := range [][]interface{}{{"div", 1, 0}, {"mod", 1.5, 1}, {"add", "1", 1}} {
+		if _, err := arithmetic(args[0].(string), args[1], args[2]); err == nil {
+			t.Errorf("%v: expected error, got none", args)
+		}
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "grender-test-funcs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(src string) { *sourceDir = src }(*sourceDir)
+	*sourceDir = filepath.Join(dir, "src")
+	Write(filepath.Join(*sourceDir, "snippets", "hello.txt"), []byte("<b>{{ hi }}</b>"))
+
+	metadata := map[string]interface{}{
+		"url":   "/blog/entry.html",
+		"title": "a *grand* entry",
+		"tags":  []interface{}{"go", "web"},
+		"count": 3.0,
+	}
+	for input, expected := range map[string]string{
+		`{{ .title | markdownify }}`:                                     "a <em>grand</em> entry",
+		`{{ .title | title }}`:                                           "A *Grand* Entry",
+		`{{ .missing | default "none" }}`:                                "none",
+		`{{ add .count 1 }}`:                                             "4",
+		`{{ (dict "k" .tags).k | jsonify }}`:                             `[&#34;go&#34;,&#34;web&#34;]`,
+		`<script>var tags = {{ jsonify .tags }};</script>`:               `<script>var tags = ["go","web"];</script>`,
+		`{{ range list 1 2 }}{{ . }}{{ end }}`:                           "12",
+		`{{ slice "abcd" 1 3 }}`:                                         "bc",
+		`{{ readFile "../snippets/hello.txt" }}`:                         "&lt;b&gt;{{ hi }}&lt;/b&gt;",
+		`{{ readFile "/snippets/hello.txt" | safeHTML }}`:                "<b>{{ hi }}</b>",
+		`{{ "  Some Words To Cut  " | trim | lower | truncateWords 2 }}`: "some words…",
+	} {
+		got := string(RenderTemplate(filepath.Join(*sourceDir, "blog", "entry.html"), []byte(input), metadata))
+		if expected != got {
+			t.Errorf("%s: expected %q, got %q", input, expected, got)
+		}
+	}
+
+	got := string(RenderTemplate(filepath.Join(*sourceDir, "feed.json.tmpl"), []byte(`{"tags": {{ jsonify .tags }}}`), metadata))
+	if expected := `{"tags": ["go","web"]}`; expected != got {
+		t.Errorf("JSON: expected %q, got %q", expected, got)
+	}
+
+	if _, err := ReadFile(filepath.Join(*sourceDir, "index.html"), "../../etc/passwd"); err == nil {
+		t.Errorf("expected error reading outside the source directory, got none")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	// GeneratedPages maps every page which declares a "generate" data file to
+	// the Stack paths of the pages generated from its records, in order.
+	GeneratedPages = map[string][]string{}
+)
+
+// Records returns the records of the data file named by the "generate"
+// metadata key, relative to the data directory. The file must hold a list of
+// maps, as every .csv file does.
+func Records(metadata map[string]interface{}) ([]map[string]interface{}, error) {
+	name, ok := metadata["generate"].(string)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("generate must name a data file")
+	}
+	if *dataDir == "" {
+		return nil, fmt.Errorf("generate needs a data directory (-data)")
+	}
+	filename := filepath.Join(DataDir(), filepath.FromSlash(name))
+	if info, err := os.Stat(filename); err != nil || info.IsDir() {
+		return nil, fmt.Errorf("data file %s doesn't exist", name)
+	}
+	parse, ok := DataParsers[strings.ToLower(filepath.Ext(filename))]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown data file type", name)
+	}
+	v, err := parse(Read(filename))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: not a list of records", name)
+	}
+	records := []map[string]interface{}{}
+	for i, element := range list {
+		record, ok := element.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: record %d isn't a map", name, i)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// GeneratedPath returns the Stack path of the i'th of n pages generated from
+// the page at path. They're zero-padded, so they sort in order.
+func GeneratedPath(path string, i, n int) string {
+	width := len(strconv.Itoa(n - 1))
+	return filepath.Join(path, fmt.Sprintf("%0*d", width, i))
+}
+
+// GatherGenerated adds a layer to the Stack for every record of the page at
+// path, beneath the page's own metadata, with the target and URL computed
+// from the page's permalink pattern. It returns the Stack paths of the
+// generated pages.
+func GatherGenerated(s StackReadWriter, path string, metadata map[string]interface{}) ([]string, error) {
+	records, err := Records(metadata)
+	if err != nil {
+		return nil, err
+	}
+	pattern, ok := metadata["permalink"].(string)
+	if !ok || pattern == "" {
+		return nil, fmt.Errorf("generated pages need a permalink")
+	}
+	paths := []string{}
+	for i, record := range records {
+		if _, ok := record["data"]; ok && *dataDir != "" {
+			return nil, fmt.Errorf("record %d: data is reserved for data files", i)
+		}
+		NormalizeDates(path, record)
+		merged := map[string]interface{}{}
+		for _, m := range []map[string]interface{}{metadata, record} {
+			for k, v := range m {
+				merged[k] = v
+			}
+		}
+		slug, ok := merged["slug"].(string)
+		if !ok || slug == "" || strings.ContainsAny(slug, "/\\") {
+			return nil, fmt.Errorf("record %d: bad slug %v", i, merged["slug"])
+		}
+		target, url, err := Permalink(pattern, path, slug, ".html", merged)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %s", i, err)
+		}
+		record["target"], record["url"] = target, url
+
+		generatedPath := GeneratedPath(path, i, len(records))
+		s.Add(generatedPath, record)
+		paths = append(paths, generatedPath)
+	}
+	return paths, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGatherGenerated(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "grender-test-generate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(src, tgt, data string) { *sourceDir, *targetDir, *dataDir = src, tgt, data }(*sourceDir, *targetDir, *dataDir)
+	*sourceDir, *targetDir, *dataDir = filepath.Join(dir, "src"), filepath.Join(dir, "tgt"), "data"
+
+	Write(filepath.Join(*sourceDir, "data", "events.csv"), []byte("slug,title,date\nlaunch,Launch,2013-01-02\nparty,Party,2014-03-04\n"))
+	path := filepath.Join(*sourceDir, "events", "event.html")
+	metadata := map[string]interface{}{
+		"generate":  "events.csv",
+		"permalink": "/:year/:slug/",
+		"layout":    "event",
+		"slug":      "event",
+	}
+
+	s := NewStack()
+	s.Add(path, metadata)
+	paths, err := GatherGenerated(s, path, metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 {
+		t.Fatalf("expected 2 generated pages, got %v", paths)
+	}
+	for i, expected := range []map[string]string{
+		{"title": "Launch", "url": "/2013/launch/", "layout": "event"},
+		{"title": "Party", "url": "/2014/party/", "layout": "event"},
+	} {
+		got := s.Get(paths[i])
+		for k, v := range expected {
+			if got[k] != v {
+				t.Errorf("page %d: expected %s %q, got %v", i, k, v, got[k])
+			}
+		}
+	}
+
+	for _, bad := range []map[string]interface{}{
+		{"generate": "events.csv"},
+		{"generate": "missing.csv", "permalink": "/:slug/"},
+		{"generate": "events.csv", "permalink": "/:bogus/"},
+	} {
+		if _, err := GatherGenerated(NewStack(), path, bad); err == nil {
+			t.Errorf("%v: expected error, got none", bad)
+		}
+	}
+}
+
+func TestGeneratedPath(t *testing.T) {
+	for _, tuple := range []struct {
+		i, n     int
+		expected string
+	}{
+		{0, 1, "a.html/0"},
+		{3, 10, "a.html/3"},
+		{3, 11, "a.html/03"},
+		{99, 100, "a.html/99"},
+	} {
+		if got := GeneratedPath("a.html", tuple.i, tuple.n); got != tuple.expected {
+			t.Errorf("%d of %d: expected %s, got %s", tuple.i, tuple.n, tuple.expected, got)
+		}
+	}
+}
@@ -3,6 +3,8 @@ module github.com/peterbourgon/grender
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/peterbourgon/mergemap v0.0.0-20130613134717-e21c03b7a721
 	github.com/russross/blackfriday v1.6.0
+	gopkg.in/yaml.v3 v3.0.1
 )
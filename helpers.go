@@ -10,6 +10,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/peterbourgon/mergemap"
 )
@@ -29,6 +30,7 @@ func Write(tgt string, buf []byte) {
 	if err := ioutil.WriteFile(tgt, buf, 0755); err != nil {
 		Fatalf("must write: %s: %s", tgt, err)
 	}
+	WrittenFiles[tgt] = true
 }
 
 // Relative gives the relative path from base for complete. complete must have
@@ -61,6 +63,30 @@ func ParseJSON(buf []byte) map[string]interface{} {
 	return m
 }
 
+// MetadataFiles returns the .json files in dir, in the order their metadata
+// is layered: lexicographically by name, except for _.json, which is last, so
+// it takes precedence.
+func MetadataFiles(dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		Fatalf("must read: %s: %s", dir, err)
+	}
+	files, underscore := []string{}, ""
+	for _, info := range infos {
+		switch {
+		case info.IsDir() || filepath.Ext(info.Name()) != ".json" || Ignored(filepath.Join(dir, info.Name())):
+		case info.Name() == "_.json":
+			underscore = filepath.Join(dir, info.Name())
+		default:
+			files = append(files, filepath.Join(dir, info.Name()))
+		}
+	}
+	if underscore != "" {
+		files = append(files, underscore)
+	}
+	return files
+}
+
 // TargetFileFor returns the target filename for the given source filename.
 func TargetFileFor(sourceFilename, targetExt string) string {
 	relativePath := Relative(*sourceDir, sourceFilename)
@@ -69,6 +95,17 @@ func TargetFileFor(sourceFilename, targetExt string) string {
 	return dst[:n] + targetExt
 }
 
+// ClaimTarget records in Targets that the file target, in the target
+// directory, is generated from the file source. It's an error if another
+// file claimed it first.
+func ClaimTarget(target, source string) error {
+	if other, ok := Targets[target]; ok && other != source {
+		return fmt.Errorf("%s and %s both map to target %s", other, source, target)
+	}
+	Targets[target] = source
+	return nil
+}
+
 // MaybeTemplate returns the contents of the template file specified under the
 // "template" key for the metadata in the stack identified by the given path.
 // In human words, it means "get me the template for this file".
@@ -185,6 +222,11 @@ func (bt BlogTuple) DateString() string {
 	return fmt.Sprintf("%04d %02d %02d", bt.Year, bt.Month, bt.Day)
 }
 
+// Date returns the date of the blog entry, at midnight in DateLocation.
+func (bt BlogTuple) Date() time.Time {
+	return time.Date(bt.Year, time.Month(bt.Month), bt.Day, 0, 0, 0, 0, DateLocation)
+}
+
 func (bt BlogTuple) TargetFileFor(baseDir string) string {
 	return filepath.Join(
 		baseDir,
@@ -255,53 +297,97 @@ func SplatInto(m map[string]interface{}, path string, metadata map[string]interf
 	m0 = mergemap.Merge(m0, metadata)
 }
 
+// withoutString returns a copy of list with every occurrence of s removed.
+func withoutString(list []string, s string) []string {
+	result := []string{}
+	for _, element := range list {
+		if element != s {
+			result = append(result, element)
+		}
+	}
+	return result
+}
+
+// toStrings converts a []string, or a []interface{} containing only strings
+// (as produced by ParseJSON), to a []string. A nil value is an empty list.
+func toStrings(i interface{}) ([]string, bool) {
+	switch v := i.(type) {
+	case nil:
+		return []string{}, true
+	case []string:
+		return v, true
+	case []interface{}:
+		list := []string{}
+		for _, element := range v {
+			s, ok := element.(string)
+			if !ok {
+				return []string{}, false
+			}
+			list = append(list, s)
+		}
+		return list, true
+	}
+	return []string{}, false
+}
+
+// setDefault sets m[key] to value, unless m already has a key.
+func setDefault(m map[string]interface{}, key string, value interface{}) {
+	if _, ok := m[key]; !ok {
+		m[key] = value
+	}
+}
+
 func PrettyPrint(i interface{}) string {
 	buf, _ := json.MarshalIndent(i, "# ", "    ")
 	return string(buf)
 }
 
-// SortedValues returns a slice of every value in the passed map, ordered by
-// the "sortkey" (if it exists) or the name of the entry (if it doesn't).
+// SortedValues returns a slice of every value in the passed map, newest first.
+// Values with a "date" are ordered by it, and precede values without one.
+// Those are ordered by "sortkey" (if it exists) or the name of the entry (if
+// it doesn't), descending.
 func SortedValues(i interface{}) []interface{} {
 	m, ok := i.(map[string]interface{})
 	if !ok {
 		Fatalf("SortedValues: expected map[string]interface{}, didn't get it")
 	}
-	mapping := map[string]string{} // sort key: original key
+	entries := sortEntries{}
 	for name, element := range m {
-		submap, ok := element.(map[string]interface{})
-		if !ok {
-			mapping[name] = name
-			continue
-		}
-		sortkey, ok := submap["sortkey"]
-		if !ok {
-			mapping[name] = name
-			continue
-		}
-		sortkeyString, ok := sortkey.(string)
-		if !ok {
-			mapping[name] = name
-			continue
+		e := sortEntry{key: name, value: element}
+		if submap, ok := element.(map[string]interface{}); ok {
+			if sortkey, ok := submap["sortkey"].(string); ok {
+				e.key = sortkey
+			}
+			e.date, e.dated = ToDate(submap["date"])
 		}
-		mapping[sortkeyString] = name
-	}
-
-	sortkeys := stringSlice{}
-	for sortkey, _ := range mapping {
-		sortkeys = append(sortkeys, sortkey)
+		entries = append(entries, e)
 	}
-	sort.Sort(sortkeys)
+	sort.Sort(entries)
 
 	orderedValues := []interface{}{}
-	for _, k := range sortkeys {
-		orderedValues = append(orderedValues, m[mapping[k]])
+	for _, e := range entries {
+		orderedValues = append(orderedValues, e.value)
 	}
 	return orderedValues
 }
 
-type stringSlice []string
+type sortEntry struct {
+	key   string
+	date  time.Time
+	dated bool
+	value interface{}
+}
+
+type sortEntries []sortEntry
 
-func (a stringSlice) Len() int           { return len(a) }
-func (a stringSlice) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a stringSlice) Less(i, j int) bool { return a[i] > a[j] }
+func (a sortEntries) Len() int      { return len(a) }
+func (a sortEntries) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a sortEntries) Less(i, j int) bool {
+	switch {
+	case a[i].dated && a[j].dated && !a[i].date.Equal(a[j].date):
+		return a[i].date.After(a[j].date)
+	case a[i].dated != a[j].dated:
+		return a[i].dated
+	}
+	return a[i].key > a[j].key
+}
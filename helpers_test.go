@@ -4,8 +4,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"io/ioutil"
+	"log"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDiffPath(t *testing.T) {
@@ -95,6 +100,97 @@ func TestMustJSON(t *testing.T) {
 	}
 }
 
+func TestMetadataFiles(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "grender-test-metadatafiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"b.json", "_.json", "A.json", "a.json", "index.html", "sub/c.json"} {
+		Write(filepath.Join(dir, name), []byte("{}"))
+	}
+	os.MkdirAll(filepath.Join(dir, "dir.json"), 0777)
+
+	expected := []string{"A.json", "a.json", "b.json", "_.json"}
+	got := []string{}
+	for _, file := range MetadataFiles(dir) {
+		got = append(got, filepath.Base(file))
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestGatherJSONOrder(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "grender-test-gatherjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(src string) { *sourceDir = src }(*sourceDir)
+	*sourceDir = dir
+
+	Write(filepath.Join(dir, "_.json"), []byte(`{"title": "Underscore", "tags": {"$append": "c"}}`))
+	Write(filepath.Join(dir, "a.json"), []byte(`{"title": "A", "layout": "page", "tags": ["a"]}`))
+	Write(filepath.Join(dir, "b.json"), []byte(`{"layout": "page", "tags": {"$append": "b"}}`))
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	s := NewStack()
+	if err := filepath.Walk(dir, GatherJSON(s)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"title":  "Underscore",
+		"layout": "page",
+		"tags":   []interface{}{"a", "b", "c"},
+	}
+	if got := s.Get(filepath.Join(dir, "index.html")); !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	warnings := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "a.json and _.json set title differently") {
+		t.Errorf("expected one warning about title, got %q", buf.String())
+	}
+}
+
+func TestGatherSourceRemove(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "grender-test-gathersource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(src, tgt string) { *sourceDir, *targetDir = src, tgt }(*sourceDir, *targetDir)
+	*sourceDir, *targetDir = filepath.Join(dir, "src"), filepath.Join(dir, "tgt")
+
+	Write(filepath.Join(*sourceDir, "_.json"), []byte(`{"banner": "INHERITED", "draft": true, "author": {"name": "Jane", "email": "jane@example.com"}}`))
+	Write(filepath.Join(*sourceDir, "page.html"), []byte(`{"banner": {"$remove": true}, "draft": {"$remove": true}, "author": {"email": {"$remove": true}}}`+"\n---\npage"))
+
+	s, m := NewStack(), map[string]interface{}{}
+	if err := filepath.Walk(*sourceDir, GatherJSON(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := filepath.Walk(*sourceDir, GatherSource(s, m, map[string]string{})); err != nil {
+		t.Fatal(err)
+	}
+	s.Add("", map[string]interface{}{"files": m})
+
+	metadata := s.Get(filepath.Join(*sourceDir, "page.html"))
+	for _, k := range []string{"banner", "draft"} {
+		if v, ok := metadata[k]; ok {
+			t.Errorf("%s: expected it removed, got %v", k, v)
+		}
+	}
+	if expected, got := map[string]interface{}{"name": "Jane"}, metadata["author"]; !reflect.DeepEqual(expected, got) {
+		t.Errorf("author: expected %v, got %v", expected, got)
+	}
+	if _, ok := metadata["files"].(map[string]interface{})["page.html"]; !ok {
+		t.Errorf("page.html isn't under files: %v", metadata["files"])
+	}
+}
+
 func TestTargetFileFor(t *testing.T) {
 	type tuple struct{ relativePath, ext string }
 	for src, expected := range map[tuple]string{
@@ -193,3 +289,45 @@ func TestSplatInto(t *testing.T) {
 	SplatInto(m, "foo", map[string]interface{}{"a": "x"})
 	assert(`{"bar":{"baz":{"x":{"y":"!","yy":"!!"}}},"foo":{"a":"x","b":2}}`)
 }
+
+func TestSortedValues(t *testing.T) {
+	m := map[string]interface{}{
+		"a.md":       map[string]interface{}{"sortkey": "a.md", "date": time.Date(2013, 1, 2, 0, 0, 0, 0, time.UTC)},
+		"b.md":       map[string]interface{}{"sortkey": "b.md", "date": time.Date(2013, 1, 15, 0, 0, 0, 0, time.UTC)},
+		"c.md":       map[string]interface{}{"sortkey": "c.md", "date": "2012-12-31"},
+		"index.html": map[string]interface{}{"sortkey": "index.html"},
+		"z.html":     map[string]interface{}{"sortkey": "z.html"},
+	}
+
+	expected := []string{"b.md", "a.md", "c.md", "z.html", "index.html"}
+	got := SortedValues(m)
+	if len(expected) != len(got) {
+		t.Fatalf("expected %d value(s), got %d", len(expected), len(got))
+	}
+	for i := range expected {
+		if sortkey := got[i].(map[string]interface{})["sortkey"]; expected[i] != sortkey {
+			t.Errorf("%d: expected %s, got %s", i, expected[i], sortkey)
+		}
+	}
+}
+
+func TestTemplateEscaper(t *testing.T) {
+	for path, expected := range map[string]string{
+		"/src/theme.css.tmpl":            "",
+		"/src/robots.txt.tmpl":           "",
+		"/src/events.ics.tmpl":           "",
+		"/src/feed.xml.tmpl":             "xml",
+		"/src/manifest.webmanifest.tmpl": "json",
+		"/src/page.html.tmpl":            "html",
+		"/src/my.css.source":             "",
+		"/src/my.js.source":              "",
+		"/src/my.html.source":            "html",
+		"/src/index.html":                "html",
+		"/src/2013-01-01-foo.md":         "html",
+		"/src/entry.template":            "html",
+	} {
+		if got := TemplateEscaper(path); expected != got {
+			t.Errorf("%s: expected %q, got %q", path, expected, got)
+		}
+	}
+}
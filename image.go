@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ImageExts are the extensions of the images grender can process.
+	ImageExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+	// imageCacheVersion is part of every cache key. Bump it whenever the
+	// output of ProcessImage changes.
+	imageCacheVersion = "1"
+)
+
+// ImageVariant is a processed image, as exposed to templates.
+type ImageVariant struct {
+	URL    string
+	Width  int
+	Height int
+}
+
+// ImageOp describes how to process an image: either resize it to Width,
+// preserving its aspect ratio (Height is 0), or crop it to the aspect ratio of
+// Width x Height around its center, and resize it to exactly that (a
+// thumbnail). Images are never enlarged.
+type ImageOp struct {
+	Width  int
+	Height int
+}
+
+// Suffix is inserted before the extension of processed images' names.
+func (op ImageOp) Suffix() string {
+	if op.Height == 0 {
+		return fmt.Sprintf("%dw", op.Width)
+	}
+	return fmt.Sprintf("%dx%d", op.Width, op.Height)
+}
+
+// ProcessImage applies op to the image asset name (relative to the source
+// directory), writes the result as an asset, and returns it. Results are
+// cached in the -image.cache directory, keyed by the source image and op. A
+// result may not overwrite another file in Targets.
+func ProcessImage(name string, op ImageOp) (ImageVariant, error) {
+	name = filepath.ToSlash(strings.TrimPrefix(name, "/"))
+	ext := strings.ToLower(filepath.Ext(name))
+	if !ImageExts[ext] {
+		return ImageVariant{}, fmt.Errorf("%s: not a JPEG, PNG or GIF image", name)
+	}
+	if op.Width <= 0 || op.Height < 0 {
+		return ImageVariant{}, fmt.Errorf("%s: bad size %s", name, op.Suffix())
+	}
+	filename := filepath.Join(*sourceDir, filepath.FromSlash(name))
+	if info, err := os.Stat(filename); err != nil || info.IsDir() {
+		return ImageVariant{}, fmt.Errorf("image %s doesn't exist", name)
+	}
+	src := Read(filename)
+
+	variantName := name[:len(name)-len(filepath.Ext(name))] + "." + op.Suffix() + filepath.Ext(name)
+	if url, ok := AssetManifest[variantName]; ok {
+		width, height, err := imageSize(Read(filepath.Join(*targetDir, filepath.FromSlash(url))))
+		return ImageVariant{url, width, height}, err
+	}
+	if err := ClaimTarget(filepath.Join(*targetDir, filepath.FromSlash(variantName)), filename); err != nil {
+		return ImageVariant{}, err
+	}
+
+	cacheFile := imageCacheFile(src, op, ext)
+	buf, err := ioutil.ReadFile(cacheFile)
+	if err == nil {
+		Debugf("image %s (%s) found in cache", name, op.Suffix())
+	} else {
+		img, _, err := image.Decode(bytes.NewReader(src))
+		if err != nil {
+			return ImageVariant{}, fmt.Errorf("%s: %s", name, err)
+		}
+		if buf, err = encodeImage(transformImage(img, op), ext); err != nil {
+			return ImageVariant{}, fmt.Errorf("%s: %s", name, err)
+		}
+		if cacheFile != "" {
+			Write(cacheFile, buf)
+		}
+		Debugf("image %s processed (%s)", name, op.Suffix())
+	}
+
+	width, height, err := imageSize(buf)
+	if err != nil {
+		return ImageVariant{}, fmt.Errorf("%s: %s", name, err)
+	}
+	return ImageVariant{WriteAsset(variantName, buf), width, height}, nil
+}
+
+// Srcset processes the image asset name to each of the widths, and returns
+// the value of a srcset attribute listing the results.
+func Srcset(name string, widths []int) (string, error) {
+	candidates := []string{}
+	for _, width := range widths {
+		variant, err := ProcessImage(name, ImageOp{Width: width})
+		if err != nil {
+			return "", err
+		}
+		candidates = append(candidates, fmt.Sprintf("%s %dw", variant.URL, variant.Width))
+	}
+	return strings.Join(candidates, ", "), nil
+}
+
+// ImageWidths returns the "imageWidths" metadata value, which lists the
+// widths every image beneath a directory should be processed to.
+func ImageWidths(metadata map[string]interface{}) ([]int, error) {
+	declared, ok := metadata["imageWidths"].([]interface{})
+	if !ok {
+		if _, present := metadata["imageWidths"]; present {
+			return nil, fmt.Errorf("imageWidths must be a list of numbers")
+		}
+		return []int{}, nil
+	}
+	widths := []int{}
+	for _, v := range declared {
+		f, ok := v.(float64)
+		if !ok || f <= 0 || f != float64(int(f)) {
+			return nil, fmt.Errorf("imageWidths: bad width %v", v)
+		}
+		widths = append(widths, int(f))
+	}
+	return widths, nil
+}
+
+// DefaultImageCache returns the default -image.cache directory, beneath the
+// user's cache directory, or "" (no cache) if there isn't one.
+func DefaultImageCache() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "grender", "images")
+}
+
+func imageCacheFile(src []byte, op ImageOp, ext string) string {
+	if *imageCache == "" {
+		return ""
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s %s\n", imageCacheVersion, op.Suffix(), ext)
+	h.Write(src)
+	return filepath.Join(*imageCache, hex.EncodeToString(h.Sum(nil))+ext)
+}
+
+func imageSize(buf []byte) (int, int, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(buf))
+	return config.Width, config.Height, err
+}
+
+func encodeImage(img image.Image, ext string) ([]byte, error) {
+	buf := bytes.Buffer{}
+	var err error
+	switch ext {
+	case ".jpg", ".jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	case ".png":
+		err = png.Encode(&buf, img)
+	case ".gif":
+		err = gif.Encode(&buf, img, nil)
+	default:
+		err = fmt.Errorf("can't encode %s", ext)
+	}
+	return buf.Bytes(), err
+}
+
+// transformImage crops and resizes img according to op.
+func transformImage(img image.Image, op ImageOp) image.Image {
+	bounds := img.Bounds()
+	width, height := op.Width, op.Height
+	if height == 0 {
+		if width >= bounds.Dx() {
+			width = bounds.Dx()
+		}
+		height = maxInt(1, bounds.Dy()*width/bounds.Dx())
+	} else {
+		// Crop to the target aspect ratio, around the center.
+		crop := bounds
+		if bounds.Dx()*height > bounds.Dy()*width {
+			w := bounds.Dy() * width / height
+			crop.Min.X += (bounds.Dx() - w) / 2
+			crop.Max.X = crop.Min.X + w
+		} else {
+			h := bounds.Dx() * height / width
+			crop.Min.Y += (bounds.Dy() - h) / 2
+			crop.Max.Y = crop.Min.Y + h
+		}
+		bounds = crop
+		if width > bounds.Dx() {
+			width, height = bounds.Dx(), bounds.Dy()
+		}
+	}
+	return resizeImage(img, bounds, width, height)
+}
+
+// resizeImage scales the part of img within bounds to width x height, by
+// averaging the source pixels which cover each destination pixel. It's meant
+// for shrinking images; enlarging them works, but looks blocky.
+func resizeImage(img image.Image, bounds image.Rectangle, width, height int) image.Image {
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	sw, sh := bounds.Dx(), bounds.Dy()
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, maxInt((y+1)*sh/height, y*sh/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, maxInt((x+1)*sw/width, x*sw/width+1)
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[i+0])
+					g += int(src.Pix[i+1])
+					b += int(src.Pix[i+2])
+					a += int(src.Pix[i+3])
+					i += 4
+					n++
+				}
+			}
+			j := dst.PixOffset(x, y)
+			dst.Pix[j+0] = uint8(r / n)
+			dst.Pix[j+1] = uint8(g / n)
+			dst.Pix[j+2] = uint8(b / n)
+			dst.Pix[j+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProcessImage(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "grender-test-image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(src, tgt, cache string) { *sourceDir, *targetDir, *imageCache = src, tgt, cache }(*sourceDir, *targetDir, *imageCache)
+	*sourceDir, *targetDir, *imageCache = filepath.Join(dir, "src"), filepath.Join(dir, "tgt"), filepath.Join(dir, "cache")
+	defer func(targets map[string]string) { Targets = targets }(Targets)
+	Targets = map[string]string{}
+
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for x := 0; x < 400; x++ {
+		for y := 0; y < 200; y++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+	buf := bytes.Buffer{}
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	Write(filepath.Join(*sourceDir, "img", "photo.png"), buf.Bytes())
+
+	for op, expected := range map[ImageOp]ImageVariant{
+		ImageOp{Width: 100}:              ImageVariant{"/img/photo.100w.png", 100, 50},
+		ImageOp{Width: 800}:              ImageVariant{"/img/photo.800w.png", 400, 200},
+		ImageOp{Width: 50, Height: 50}:   ImageVariant{"/img/photo.50x50.png", 50, 50},
+		ImageOp{Width: 300, Height: 300}: ImageVariant{"/img/photo.300x300.png", 200, 200},
+	} {
+		got, err := ProcessImage("img/photo.png", op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected != got {
+			t.Errorf("%s: expected %+v, got %+v", op.Suffix(), expected, got)
+		}
+		if _, err := os.Stat(filepath.Join(*targetDir, got.URL)); err != nil {
+			t.Errorf("%s: %s", op.Suffix(), err)
+		}
+	}
+
+	cached, err := ioutil.ReadDir(*imageCache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 4, len(cached); expected != got {
+		t.Errorf("expected %d cached image(s), got %d", expected, got)
+	}
+
+	srcset, err := Srcset("img/photo.png", []int{100, 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "/img/photo.100w.png 100w, /img/photo.200w.png 200w"; expected != srcset {
+		t.Errorf("expected %q, got %q", expected, srcset)
+	}
+
+	if _, err := ProcessImage("img/missing.png", ImageOp{Width: 10}); err == nil {
+		t.Errorf("expected error for missing image, got none")
+	}
+
+	Targets[filepath.Join(*targetDir, "img", "photo.50w.png")] = filepath.Join(*sourceDir, "img", "photo.50w.png")
+	if _, err := ProcessImage("img/photo.png", ImageOp{Width: 50}); err == nil {
+		t.Errorf("expected error for variant overwriting a source file, got none")
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// WrittenFiles records every file written by Write, so the link checker
+	// knows what this build produced, as opposed to what's left over in the
+	// target directory from earlier ones.
+	WrittenFiles = map[string]bool{}
+
+	htmlCommentRegexp   = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlRawRegexps      = rawElementRegexps()
+	htmlTagRegexp       = regexp.MustCompile(`(?i)<([a-z][a-z0-9-]*)\b[^>]*>`)
+	htmlAttributeRegexp = regexp.MustCompile(`(?i)\s(href|src|srcset|id|name)\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+)`)
+)
+
+// BrokenLink is a reference from a page in the target directory to something
+// this build didn't write.
+type BrokenLink struct {
+	Page   string // target file
+	Ref    string // as written in the page
+	Reason string
+}
+
+// HTMLRefs returns every href, src and srcset URL in the HTML buf, in order,
+// and the set of its element ids (and anchor names), which fragments can
+// refer to. The content of rawElements, such as code samples, is skipped.
+func HTMLRefs(buf []byte) ([]string, map[string]bool) {
+	buf = htmlCommentRegexp.ReplaceAll(buf, nil)
+	for _, re := range htmlRawRegexps {
+		buf = re.ReplaceAll(buf, []byte("$1$2"))
+	}
+	refs, ids := []string{}, map[string]bool{}
+	for _, tag := range htmlTagRegexp.FindAllSubmatch(buf, -1) {
+		anchor := strings.EqualFold(string(tag[1]), "a")
+		for _, match := range htmlAttributeRegexp.FindAllSubmatch(tag[0], -1) {
+			value := html.UnescapeString(strings.Trim(string(match[2]), `"'`))
+			switch strings.ToLower(string(match[1])) {
+			case "href", "src":
+				refs = append(refs, strings.TrimSpace(value))
+			case "srcset":
+				for _, candidate := range strings.Split(value, ",") {
+					if fields := strings.Fields(candidate); len(fields) > 0 {
+						refs = append(refs, fields[0])
+					}
+				}
+			case "id":
+				ids[value] = true
+			case "name":
+				if anchor {
+					ids[value] = true // <a name>, the old way to make an anchor
+				}
+			}
+		}
+	}
+	return refs, ids
+}
+
+// rawElementRegexps returns a regexp for each of the rawElements, matching its
+// start tag, content and end tag.
+func rawElementRegexps() []*regexp.Regexp {
+	regexps := []*regexp.Regexp{}
+	for _, name := range rawElements {
+		regexps = append(regexps, regexp.MustCompile(`(?is)(<`+name+`\b[^>]*>).*?(</`+name+`\s*>)`))
+	}
+	return regexps
+}
+
+// CheckLinks checks every internal reference in every HTML file written by
+// this build: it must resolve to a file written by this build, such as a
+// redirect stub, and if it has a fragment, and refers to an HTML page, the
+// fragment must be the id of an element in it.
+func CheckLinks(redirects []Redirect) []BrokenLink {
+	stubs := map[string]bool{}
+	for _, r := range redirects {
+		stubs[RedirectFile(r.From)] = true
+	}
+	pages := []string{}
+	for file := range WrittenFiles {
+		switch filepath.Ext(file) {
+		case ".html", ".htm":
+			if strings.HasPrefix(file, *targetDir+string(filepath.Separator)) {
+				pages = append(pages, file)
+			}
+		}
+	}
+	sort.Strings(pages)
+
+	pageIDs := map[string]map[string]bool{}
+	idsOf := func(file string) map[string]bool {
+		if _, ok := pageIDs[file]; !ok {
+			_, pageIDs[file] = HTMLRefs(Read(file))
+		}
+		return pageIDs[file]
+	}
+
+	broken := []BrokenLink{}
+	for _, page := range pages {
+		base := &url.URL{Path: "/" + filepath.ToSlash(Relative(*targetDir, page))}
+		refs, ids := HTMLRefs(Read(page))
+		pageIDs[page] = ids
+		for _, ref := range refs {
+			u, err := url.Parse(ref)
+			if err != nil {
+				broken = append(broken, BrokenLink{page, ref, "malformed URL"})
+				continue
+			}
+			if u.Scheme != "" || u.Host != "" || u.Path == "" && u.Fragment == "" {
+				continue // external, or e.g. "?page=2"
+			}
+			resolved := base.ResolveReference(u)
+			file, ok := targetFileForURL(resolved.Path)
+			if !ok {
+				broken = append(broken, BrokenLink{page, ref, fmt.Sprintf("%s wasn't written", resolved.Path)})
+				continue
+			}
+			if u.Fragment == "" || u.Fragment == "top" || stubs[file] {
+				continue
+			}
+			switch filepath.Ext(file) {
+			case ".html", ".htm":
+				if !idsOf(file)[u.Fragment] {
+					broken = append(broken, BrokenLink{page, ref, fmt.Sprintf("%s has no element with id %q", resolved.Path, u.Fragment)})
+				}
+			}
+		}
+	}
+	return broken
+}
+
+// targetFileForURL returns the file written by this build which is served
+// under the URL path p.
+func targetFileForURL(p string) (string, bool) {
+	file := filepath.Join(*targetDir, filepath.FromSlash(p))
+	if file != *targetDir && !strings.HasPrefix(file, *targetDir+string(filepath.Separator)) {
+		return "", false
+	}
+	if !strings.HasSuffix(p, "/") && WrittenFiles[file] {
+		return file, true
+	}
+	if index := filepath.Join(file, "index.html"); WrittenFiles[index] {
+		return index, true
+	}
+	return "", false
+}
+
+// ReportBrokenLinks warns about every broken link, grouped by the source file
+// of the page they're in, according to targets (target: source).
+func ReportBrokenLinks(broken []BrokenLink, targets map[string]string) {
+	bySource := map[string][]BrokenLink{}
+	sources := []string{}
+	for _, b := range broken {
+		source, ok := targets[b.Page]
+		if !ok {
+			source = b.Page // e.g. a redirect stub
+		}
+		if _, ok := bySource[source]; !ok {
+			sources = append(sources, source)
+		}
+		bySource[source] = append(bySource[source], b)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		lines := []string{}
+		for _, b := range bySource[source] {
+			lines = append(lines, fmt.Sprintf("  %s: %s", b.Ref, b.Reason))
+		}
+		Warningf("%s: %d broken link(s)\n%s", source, len(lines), strings.Join(lines, "\n"))
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestHTMLRefs(t *testing.T) {
+	buf := []byte(`<a href="/a.html">a</a> <img src='b.png' srcset="b.640w.png 640w, b.1280w.png 1280w">
+<h2 id="intro">Intro</h2><a name=old>x</a><!-- <a href="/commented.html"> -->
+<script src="/c.js">var s = "<a href='/in-script.html'>";</script><a data-href="/not-a-link.html" href="/d.html?x=1&amp;y=2">d</a>
+<meta name="description" content="x"><input name="q"><pre><a href="/in-pre.html" id="in-pre">sample</a></pre>`)
+	refs, ids := HTMLRefs(buf)
+	if expected := []string{"/a.html", "b.png", "b.640w.png", "b.1280w.png", "/c.js", "/d.html?x=1&y=2"}; !reflect.DeepEqual(expected, refs) {
+		t.Errorf("expected refs %v, got %v", expected, refs)
+	}
+	if expected := map[string]bool{"intro": true, "old": true}; !reflect.DeepEqual(expected, ids) {
+		t.Errorf("expected ids %v, got %v", expected, ids)
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "grender-test-linkcheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(tgt string, written map[string]bool) { *targetDir, WrittenFiles = tgt, written }(*targetDir, WrittenFiles)
+	*targetDir, WrittenFiles = filepath.Join(dir, "tgt"), map[string]bool{}
+
+	// Left over from an earlier build; links to it are broken.
+	os.MkdirAll(*targetDir, 0777)
+	ioutil.WriteFile(filepath.Join(*targetDir, "stale.html"), []byte{}, 0644)
+
+	Write(filepath.Join(*targetDir, "index.html"), []byte(`
+<a href="blog/">blog</a> <a href="/blog/first.html#intro">intro</a> <a href="blog/first.html#nope">nope</a>
+<a href="/old.html#intro">old</a> <a href="https://example.com/missing.html">external</a> <a href="#">top</a>
+<a href="/stale.html">stale</a> <img src="img/missing.png"> <a href="/blog/first.html?ref=home">query</a>`))
+	Write(filepath.Join(*targetDir, "blog", "index.html"), []byte(`<a href="first.html">first</a> <a href="../../outside.html">out</a>`))
+	Write(filepath.Join(*targetDir, "blog", "first.html"), []byte(`<h1 id="intro">Intro</h1> <a href="#intro">self</a> <a href="#gone">gone</a>`))
+	WriteRedirects([]Redirect{{From: "/old.html", To: "/blog/first.html"}})
+
+	got := []string{}
+	for _, b := range CheckLinks([]Redirect{{From: "/old.html", To: "/blog/first.html"}}) {
+		got = append(got, Relative(*targetDir, b.Page)+" "+b.Ref)
+	}
+	sort.Strings(got)
+	expected := []string{
+		"blog/first.html #gone",
+		"blog/index.html ../../outside.html",
+		"index.html /stale.html",
+		"index.html blog/first.html#nope",
+		"index.html img/missing.png",
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected\n%v\ngot\n%v", expected, got)
+	}
+}
@@ -3,10 +3,14 @@ package main
 import (
 	"bytes"
 	"flag"
+	"fmt"
 	"html/template"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	texttemplate "text/template"
+	"time"
 
 	"github.com/peterbourgon/mergemap"
 	"github.com/russross/blackfriday"
@@ -17,30 +21,98 @@ var (
 )
 
 var (
-	debug     = flag.Bool("debug", false, "print debug information")
-	sourceDir = flag.String("source", "src", "path to site source (input)")
-	targetDir = flag.String("target", "tgt", "path to site target (output)")
-	globalKey = flag.String("global.key", "files", "template node name for per-file metadata")
+	debug        = flag.Bool("debug", false, "print debug information")
+	sourceDir    = flag.String("source", "src", "path to site source (input)")
+	targetDir    = flag.String("target", "tgt", "path to site target (output)")
+	globalKey    = flag.String("global.key", "files", "template node name for per-file metadata")
+	timezone     = flag.String("timezone", "Local", "time zone for dates without an explicit offset")
+	drafts       = flag.Bool("drafts", false, "render files marked as drafts")
+	future       = flag.Bool("future", false, "render files dated in the future")
+	expired      = flag.Bool("expired", false, "render files past their expiryDate")
+	redirectMaps = flag.String("redirects", "", "comma-separated server redirect maps to write (netlify, nginx, apache)")
+	minify       = flag.Bool("minify", false, "minify CSS, JS, JSON, SVG and HTML output")
+	fingerprint  = flag.String("fingerprint", "", "comma-separated extensions of assets to fingerprint (e.g. .css,.js)")
+	imageCache   = flag.String("image.cache", DefaultImageCache(), "directory to cache processed images in (empty to disable)")
+	checkLinks   = flag.String("check.links", "", "check internal links in the output, and warn about broken ones (warn) or fail the build (fail)")
+	strict       = flag.Bool("strict", false, "fail when a template refers to a missing metadata key")
+	dumpMetadata = flag.String("dump-metadata", "", "print the merged metadata of a source file, and where each key came from, instead of rendering")
+	dataDir      = flag.String("data", "", "directory of data files, relative to -source (e.g. data; none by default)")
+	configFile   = flag.String("config", "", "site configuration file (default grender.json or grender.yaml, if there is one)")
+	baseURL      = flag.String("base.url", "", "URL the site is served from, for absURL")
+	ignore       = flag.String("ignore", "", "comma-separated globs of source files to ignore")
+	env          = flag.String("env", "", "environment to build for (production, staging, dev, or one in the site configuration)")
 )
 
-func init() {
+func main() {
 	flag.Parse()
 
 	var err error
+	config := Config{Markdown: Markdown}
+	if file := ConfigFile(); file != "" {
+		if config, err = ParseConfig(file, Read(file), *env); err != nil {
+			Fatalf("%s: %s", file, err)
+		}
+		if err = ApplyConfig(flag.CommandLine, config, filepath.Dir(file)); err != nil {
+			Fatalf("%s: %s", file, err)
+		}
+		if ConfigPath, err = filepath.Abs(file); err != nil {
+			Fatalf("%s", err)
+		}
+	} else if *env != "" && !StandardEnv(*env) {
+		Fatalf("-env: no environment %q", *env)
+	}
 	for _, s := range []*string{sourceDir, targetDir} {
 		if *s, err = filepath.Abs(*s); err != nil {
 			Fatalf("%s", err)
 		}
 	}
-}
+	if DateLocation, err = time.LoadLocation(*timezone); err != nil {
+		Fatalf("%s", err)
+	}
+	redirectFormats := []string{}
+	for _, format := range strings.Split(*redirectMaps, ",") {
+		if format = strings.TrimSpace(format); format == "" {
+			continue
+		}
+		if _, ok := RedirectMaps[format]; !ok {
+			Fatalf("-redirects: unknown format %q", format)
+		}
+		redirectFormats = append(redirectFormats, format)
+	}
+	if *checkLinks != "" && *checkLinks != "warn" && *checkLinks != "fail" {
+		Fatalf("-check.links: must be warn or fail, not %q", *checkLinks)
+	}
 
-func main() {
 	m := map[string]interface{}{}
 	s := NewStack()
+	s.AddNamed("", ConfigFile(), SiteMetadata(config))
+	if metadata := EnvMetadata(config); metadata != nil {
+		s.AddNamed("", fmt.Sprintf("%s (%s)", ConfigFile(), *env), metadata)
+	}
 	filepath.Walk(*sourceDir, GatherJSON(s))
-	filepath.Walk(*sourceDir, GatherSource(s, m))
+	filepath.Walk(*sourceDir, GatherSource(s, m, Targets))
+	if len(InvalidPages) > 0 {
+		Fatalf("%d page(s) with invalid metadata", len(InvalidPages))
+	}
+	redirects := GatherRedirects(s, Targets)
 	s.Add("", map[string]interface{}{*globalKey: m})
+	Data = LoadData()
+	if *dumpMetadata != "" {
+		DumpMetadata(os.Stdout, s, DumpPath(s, *dumpMetadata))
+		return
+	}
+	filepath.Walk(*sourceDir, TransformTemplated(s))
 	filepath.Walk(*sourceDir, Transform(s))
+	WriteRedirects(redirects)
+	WriteRedirectMaps(redirects, redirectFormats)
+	WriteAssetManifest()
+	if *checkLinks != "" {
+		broken := CheckLinks(redirects)
+		ReportBrokenLinks(broken, Targets)
+		if len(broken) > 0 && *checkLinks == "fail" {
+			Fatalf("%d broken link(s)", len(broken))
+		}
+	}
 }
 
 // splitMetadata splits the input buffer on FrontSeparator. It returns a byte-
@@ -54,73 +126,199 @@ func splitMetadata(buf []byte) ([]byte, []byte) {
 	return []byte{}, buf
 }
 
+// GatherJSON returns a WalkFunc which adds the metadata in every directory's
+// .json files to the Stack, layered in MetadataFiles order, and records the
+// cascades they declare. It warns when two of them set a key differently.
 func GatherJSON(s StackReadWriter) filepath.WalkFunc {
 	Debugf("gathering JSON")
 	return func(path string, info os.FileInfo, _ error) error {
-		if info.IsDir() {
-			return nil // descend
+		if IsDataDir(path) {
+			return filepath.SkipDir
 		}
-		switch filepath.Ext(path) {
-		case ".json":
-			metadata := ParseJSON(Read(path))
-			s.Add(filepath.Dir(path), metadata)
-			Debugf("%s gathered (%d element(s))", path, len(metadata))
+		if Ignored(path) {
+			return skip(info)
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		gathered := []Origin{}
+		for _, file := range MetadataFiles(path) {
+			metadata := ParseJSON(Read(file))
+			name := filepath.ToSlash(Relative(*sourceDir, file))
+			cascades, err := ParseCascades(file, name, metadata)
+			if err != nil {
+				Fatalf("%s: %s", file, err)
+			}
+			delete(metadata, "cascade")
+			CheckDataKey(file, metadata)
+			for _, c := range cascades {
+				CheckDataKey(c.Name, c.Metadata)
+			}
+			key := StackKey(path)
+			Cascades[key] = append(Cascades[key], cascades...)
+			for _, earlier := range gathered {
+				for _, key := range ConflictingKeys(earlier.Metadata, metadata) {
+					Warningf("%s and %s set %s differently; %s takes precedence", earlier.Name, name, key, name)
+				}
+			}
+			gathered = append(gathered, Origin{Name: name, Metadata: metadata})
+			s.AddNamed(path, name, metadata)
+			Debugf("%s gathered (%d element(s))", file, len(metadata))
 		}
 		return nil
 	}
 }
 
-func GatherSource(s StackReadWriter, m map[string]interface{}) filepath.WalkFunc {
+// GatherSource returns a WalkFunc which computes the complete metadata for
+// every source file, adds it to the Stack, and (if the file is publishable)
+// splats it into m under its path relative to the source directory, and
+// records it in targets under its target filename. Other files which are
+// written to the target directory are recorded in targets, too. It fatals if
+// two files would be written to the same target, and records pages whose
+// metadata violates their schema in InvalidPages.
+func GatherSource(s StackReadWriter, m map[string]interface{}, targets map[string]string) filepath.WalkFunc {
 	Debugf("gathering source")
+	claim := func(target, path string) {
+		if other, ok := targets[target]; ok {
+			Fatalf("%s and %s both map to target %s", other, path, target)
+		}
+		targets[target] = path
+	}
+	validate := func(path string, metadata map[string]interface{}) {
+		if violations := Validate(metadata); len(violations) > 0 {
+			Warningf("%s: invalid metadata:\n  %s", path, strings.Join(violations, "\n  "))
+			InvalidPages = append(InvalidPages, path)
+		}
+	}
 	return func(path string, info os.FileInfo, _ error) error {
+		if IsDataDir(path) {
+			return filepath.SkipDir
+		}
+		if Ignored(path) {
+			return skip(info)
+		}
 		if info.IsDir() {
 			return nil // descend
 		}
 		switch filepath.Ext(path) {
-		case ".html":
-			defaultMetadata := map[string]interface{}{
-				"source":  path,
-				"target":  TargetFileFor(path, filepath.Ext(path)),
-				"url":     "/" + Relative(*targetDir, TargetFileFor(path, filepath.Ext(path))),
-				"sortkey": filepath.Base(path),
+		case ".html", ".md":
+		case ".json", ".source", ".template":
+			return nil
+		default:
+			// Not a source file, but it's copied or rendered into the target
+			// directory all the same.
+			if !strings.HasPrefix(filepath.Base(path), ".") {
+				claim(strings.TrimSuffix(TargetFileFor(path, filepath.Ext(path)), ".tmpl"), path)
 			}
-			fileMetadata := map[string]interface{}{}
-			fileMetadataBuf, _ := splitMetadata(Read(path))
-			if len(fileMetadataBuf) > 0 {
-				fileMetadata = ParseJSON(fileMetadataBuf)
+			return nil
+		}
+		targetExt := ".html"
+
+		base := filepath.Base(path)
+		blogTuple, isBlogEntry := BlogTuple{}, false
+		if filepath.Ext(path) == ".md" {
+			blogTuple, isBlogEntry = NewBlogTuple(path, targetExt)
+		}
+		defaultMetadata := map[string]interface{}{
+			"source":  path,
+			"sortkey": base,
+			"slug":    base[:len(base)-len(filepath.Ext(base))],
+		}
+		if isBlogEntry {
+			defaultMetadata["title"] = blogTuple.Title
+			defaultMetadata["date"] = blogTuple.Date()
+			defaultMetadata["slug"] = strings.TrimSuffix(blogTuple.Filename, targetExt)
+		}
+		fileMetadata := map[string]interface{}{}
+		fileMetadataBuf, _ := splitMetadata(Read(path))
+		if len(fileMetadataBuf) > 0 {
+			fileMetadata = ParseJSON(fileMetadataBuf)
+			CheckDataKey(path, fileMetadata)
+		}
+		merge := func(inheritedMetadata map[string]interface{}) map[string]interface{} {
+			metadata := MergeMetadata(map[string]interface{}{}, defaultMetadata)
+			return MergeMetadata(metadata, MergeMetadata(inheritedMetadata, fileMetadata))
+		}
+
+		// Cascades are layered over the metadata of the directory which
+		// declares them, so deeper directories can override them. They're
+		// matched against the file's metadata without any of them.
+		cascades := CascadesFor(path, merge(s.Get(path)))
+		metadata := merge(s.GetLayered(path, CascadeLayers(cascades)))
+		NormalizeDates(path, metadata)
+
+		// The target and URL follow from the slug, which may be overridden,
+		// and the permalink pattern, if there is one.
+		slug, ok := metadata["slug"].(string)
+		if !ok || slug == "" || strings.ContainsAny(slug, "/\\") {
+			Fatalf("%s: bad slug %v", path, metadata["slug"])
+		}
+		target := filepath.Join(filepath.Dir(TargetFileFor(path, targetExt)), slug+targetExt)
+		var redirects []string
+		if isBlogEntry {
+			baseDir := filepath.Join(*targetDir, Relative(*sourceDir, filepath.Dir(path)))
+			blogTuple.Filename = slug + targetExt
+			target = blogTuple.TargetFileFor(baseDir)
+			redirects = blogTuple.RedirectFromURLs(baseDir)
+		}
+		url := "/" + Relative(*targetDir, target)
+		if pattern, ok := metadata["permalink"].(string); ok && pattern != "" {
+			permalinkTarget, permalinkURL, err := Permalink(pattern, path, slug, targetExt, metadata)
+			if err != nil {
+				Fatalf("%s: %s", path, err)
 			}
-			inheritedMetadata := s.Get(path)
-			metadata := mergemap.Merge(defaultMetadata, mergemap.Merge(inheritedMetadata, fileMetadata))
-			s.Add(path, metadata)
-			SplatInto(m, Relative(*sourceDir, path), metadata)
-			Debugf("%s gathered (%d element(s))", path, len(metadata))
-
-		case ".md":
-			defaultMetadata := map[string]interface{}{
-				"source":  path,
-				"target":  TargetFileFor(path, ".html"),
-				"url":     "/" + Relative(*targetDir, TargetFileFor(path, ".html")),
-				"sortkey": filepath.Base(path),
+			if isBlogEntry {
+				// The blog entry may have moved away from its default target,
+				// and onto one of its default redirects.
+				redirects = append(redirects, url)
 			}
-			if blogTuple, ok := NewBlogTuple(path, ".html"); ok {
-				baseDir := filepath.Join(*targetDir, Relative(*sourceDir, filepath.Dir(path)))
-				defaultMetadata["title"] = blogTuple.Title
-				defaultMetadata["date"] = blogTuple.DateString()
-				defaultMetadata["target"] = blogTuple.TargetFileFor(baseDir)
-				defaultMetadata["url"] = "/" + Relative(*targetDir, blogTuple.TargetFileFor(baseDir))
-				defaultMetadata["redirects"] = blogTuple.RedirectFromURLs(baseDir)
+			target, url = permalinkTarget, permalinkURL
+		}
+		setDefault(metadata, "target", target)
+		setDefault(metadata, "url", url)
+		if isBlogEntry {
+			setDefault(metadata, "redirects", withoutString(redirects, "/"+Relative(*targetDir, target)))
+		}
+		if aliases, ok := metadata["aliases"]; ok {
+			metadata["aliases"] = AliasURLs(path, aliases)
+		}
+
+		name := filepath.ToSlash(Relative(*sourceDir, path))
+		s.AddComplete(path, name, metadata)
+		s.AddOrigin(path, Origin{Name: name + " (defaults)", Metadata: defaultMetadata, Default: true})
+		for _, c := range cascades {
+			s.AddOrigin(path, Origin{Name: c.Name, Metadata: c.Metadata, Over: StackKey(c.Dir)})
+		}
+		s.AddOrigin(path, Origin{Name: name + " (front matter)", Metadata: fileMetadata})
+		if ok, reason := Publishable(metadata, *drafts, *future, *expired); !ok {
+			Debugf("%s gathered but not published (%s)", path, reason)
+			return nil
+		}
+		if _, ok := metadata["generate"]; ok {
+			generated, err := GatherGenerated(s, path, metadata)
+			if err != nil {
+				Fatalf("%s: %s", path, err)
 			}
-			fileMetadata := map[string]interface{}{}
-			fileMetadataBuf, _ := splitMetadata(Read(path))
-			if len(fileMetadataBuf) > 0 {
-				fileMetadata = ParseJSON(fileMetadataBuf)
+			GeneratedPages[path] = generated
+			for _, generatedPath := range generated {
+				generatedMetadata := s.Get(generatedPath)
+				if ok, reason := Publishable(generatedMetadata, *drafts, *future, *expired); !ok {
+					Debugf("%s gathered but not published (%s)", generatedPath, reason)
+					continue
+				}
+				validate(generatedPath, generatedMetadata)
+				target, _ = generatedMetadata["target"].(string)
+				claim(target, generatedPath)
+				SplatInto(m, Relative(*sourceDir, generatedPath), generatedMetadata)
 			}
-			inheritedMetadata := s.Get(path)
-			metadata := mergemap.Merge(defaultMetadata, mergemap.Merge(inheritedMetadata, fileMetadata))
-			s.Add(path, metadata)
-			SplatInto(m, Relative(*sourceDir, path), metadata)
-			Debugf("%s gathered (%d element(s))", path, len(metadata))
+			Debugf("%s gathered (%d page(s) generated)", path, len(generated))
+			return nil
 		}
+		validate(path, metadata)
+		target, _ = metadata["target"].(string)
+		claim(target, path)
+		SplatInto(m, Relative(*sourceDir, path), metadata)
+		Debugf("%s gathered (%d element(s))", path, len(metadata))
 		return nil
 	}
 }
@@ -128,6 +326,14 @@ func GatherSource(s StackReadWriter, m map[string]interface{}) filepath.WalkFunc
 func Transform(s StackReader) filepath.WalkFunc {
 	Debugf("transforming")
 	return func(path string, info os.FileInfo, _ error) error {
+		if IsDataDir(path) {
+			Debugf("skip data directory %s", path)
+			return filepath.SkipDir
+		}
+		if Ignored(path) {
+			Debugf("skip ignored %s", path)
+			return skip(info)
+		}
 		if strings.HasPrefix(filepath.Base(path), ".") {
 			Debugf("skip hidden file %s", path)
 			return nil
@@ -142,60 +348,136 @@ func Transform(s StackReader) filepath.WalkFunc {
 		case ".json":
 			Debugf("%s ignored for transformation", path)
 
-		case ".html":
-			// read
-			_, contentBuf := splitMetadata(Read(path))
+		case ".html", ".md":
+			pages, ok := GeneratedPages[path]
+			if !ok {
+				pages = []string{path}
+			}
+			for _, page := range pages {
+				TransformPage(s, path, page)
+			}
 
-			// render
-			outputBuf := RenderTemplate(path, contentBuf, s.Get(path))
+		case ".source", ".template":
+			Debugf("%s ignored for transformation", path)
 
-			// write
-			dst := TargetFileFor(path, filepath.Ext(path))
-			Write(dst, outputBuf)
-			Debugf("%s transformed to %s", path, dst)
+		case ".tmpl":
+			Debugf("%s already transformed", path)
 
-		case ".md":
-			// read
-			_, contentBuf := splitMetadata(Read(path))
+		default:
+			url := WriteAsset(Relative(*sourceDir, path), Read(path))
+			Debugf("%s transformed to %s", path, url)
 
-			// render
-			var htmlBits, extensionBits int
-			metadata := s.Get(path)
-			if v, ok := metadata["toc"]; ok && v.(bool) {
-				htmlBits |= blackfriday.HTML_TOC
-			}
-			md := RenderTemplate(path, contentBuf, metadata)
-			metadata = mergemap.Merge(metadata, map[string]interface{}{
-				"content": template.HTML(RenderMarkdown(md, htmlBits, extensionBits)),
-			})
-			templatePath, templateBuf := Template(s, path)
-			outputBuf := RenderTemplate(templatePath, templateBuf, metadata)
-
-			// write file
-			dst, _ := metadata["target"].(string)
-			Write(dst, outputBuf)
-
-			// write redirects
-			if redirectsInterface, ok := metadata["redirects"]; ok {
-				redirectToUrl, _ := metadata["url"].(string)
-				redirectFromUrls, _ := redirectsInterface.([]string)
-				for _, redirectFromUrl := range redirectFromUrls {
-					redirectFromFile := filepath.Join(*targetDir, redirectFromUrl)
-					Write(redirectFromFile, RedirectTo(redirectToUrl))
+			if ImageExts[strings.ToLower(filepath.Ext(path))] {
+				widths, err := ImageWidths(s.Get(path))
+				if err != nil {
+					Fatalf("%s: %s", path, err)
+				}
+				for _, width := range widths {
+					variant, err := ProcessImage(Relative(*sourceDir, path), ImageOp{Width: width})
+					if err != nil {
+						Fatalf("%s", err)
+					}
+					Debugf("%s transformed to %s", path, variant.URL)
 				}
 			}
+		}
+		return nil
+	}
+}
 
-			// done
-			Debugf("%s transformed to %s", path, dst)
+// TransformPage renders the source file at path with the metadata of the
+// Stack path page, which is path itself, unless the page was generated from
+// one of its records, and writes it to its target.
+func TransformPage(s StackReader, path, page string) {
+	metadata := s.Get(page)
+	if ok, reason := Publishable(metadata, *drafts, *future, *expired); !ok {
+		Debugf("%s not published (%s)", page, reason)
+		return
+	}
+	BuildBundles(path, metadata)
+
+	switch filepath.Ext(path) {
+	case ".html":
+		// read
+		_, contentBuf := splitMetadata(Read(path))
+
+		// render
+		outputBuf := RenderTemplate(path, contentBuf, metadata)
+
+		// write
+		dst, _ := metadata["target"].(string)
+		WriteOutput(dst, outputBuf)
+		Debugf("%s transformed to %s", page, dst)
+
+	case ".md":
+		// read
+		_, contentBuf := splitMetadata(Read(path))
+
+		// render
+		var htmlBits, extensionBits int
+		toc := Markdown.TOC
+		if v, ok := metadata["toc"].(bool); ok {
+			toc = v
+		}
+		if toc {
+			htmlBits |= blackfriday.HTML_TOC
+		}
+		md := RenderTemplate(path, contentBuf, metadata)
+		files, _ := metadata[*globalKey].(map[string]interface{})
+		content, err := RenderMarkdown(md, htmlBits, extensionBits, func(link string) (string, error) {
+			return MarkdownRef(files, path, link)
+		})
+		if err != nil {
+			Fatalf("%s: %s", path, err)
+		}
+		metadata = mergemap.Merge(metadata, map[string]interface{}{
+			"content": template.HTML(content),
+		})
+		templatePath, templateBuf := Template(s, path)
+		outputBuf := RenderTemplate(templatePath, templateBuf, metadata)
+
+		// write file
+		dst, _ := metadata["target"].(string)
+		WriteOutput(dst, outputBuf)
+
+		// done
+		Debugf("%s transformed to %s", page, dst)
+	}
+}
 
-		case ".source", ".template":
-			Debugf("%s ignored for transformation", path)
+// TransformTemplated returns a WalkFunc which renders every .tmpl file with
+// its metadata, and writes it as an asset without the .tmpl suffix. They're
+// transformed before anything else, so every page can refer to them with the
+// asset template function.
+func TransformTemplated(s StackReader) filepath.WalkFunc {
+	Debugf("transforming .tmpl files")
+	return func(path string, info os.FileInfo, _ error) error {
+		if IsDataDir(path) {
+			return filepath.SkipDir
+		}
+		if Ignored(path) {
+			return skip(info)
+		}
+		if strings.HasPrefix(filepath.Base(path), ".") || info.IsDir() || filepath.Ext(path) != ".tmpl" {
+			return nil
+		}
 
-		default:
-			dst := TargetFileFor(path, filepath.Ext(path))
-			Copy(dst, path)
-			Debugf("%s transformed to %s verbatim", path, dst)
+		// read
+		metadataBuf, contentBuf := splitMetadata(Read(path))
+		name := strings.TrimSuffix(Relative(*sourceDir, path), ".tmpl")
+		metadata := mergemap.Merge(map[string]interface{}{
+			"source": path,
+			"url":    "/" + filepath.ToSlash(name),
+		}, s.Get(path))
+		if len(metadataBuf) > 0 {
+			fileMetadata := ParseJSON(metadataBuf)
+			CheckDataKey(path, fileMetadata)
+			metadata = MergeMetadata(metadata, fileMetadata)
 		}
+
+		// render and write
+		url := WriteAsset(name, RenderTemplate(path, contentBuf, metadata))
+		Debugf("%s transformed to %s", path, url)
 		return nil
 	}
 }
@@ -221,31 +503,145 @@ func RenderTemplate(path string, input []byte, metadata map[string]interface{})
 		"importcss":  importcss,
 		"importjs":   importjs,
 		"sorted":     SortedValues,
+		"sortBy":     SortBy,
+		"where":      Where,
+		"first":      First,
+		"last":       Last,
+		"limit":      Limit,
+		"reverse":    Reverse,
+		"groupBy":    GroupBy,
+		"bundle": func(name string) (string, error) {
+			return BuildBundle(metadata, name)
+		},
+		"asset": func(name string) (string, error) {
+			return Asset(path, name)
+		},
+		"integrity": func(name string) (string, error) {
+			_, integrity, err := Integrity(path, name)
+			return integrity, err
+		},
+		"script": func(name string) (template.HTML, error) {
+			return ScriptTag(path, name)
+		},
+		"stylesheet": func(name string) (template.HTML, error) {
+			return StylesheetTag(path, name)
+		},
+		"image": func(name string, width int) (ImageVariant, error) {
+			name, err := AssetName(path, name)
+			if err != nil {
+				return ImageVariant{}, err
+			}
+			return ProcessImage(name, ImageOp{Width: width})
+		},
+		"thumbnail": func(name string, width, height int) (ImageVariant, error) {
+			name, err := AssetName(path, name)
+			if err != nil {
+				return ImageVariant{}, err
+			}
+			return ProcessImage(name, ImageOp{Width: width, Height: height})
+		},
+		"srcset": func(name string, widths ...int) (string, error) {
+			name, err := AssetName(path, name)
+			if err != nil {
+				return "", err
+			}
+			return Srcset(name, widths)
+		},
+		"ref": func(name string) (string, error) {
+			files, _ := metadata[*globalKey].(map[string]interface{})
+			return Ref(files, path, name)
+		},
+		"date": FormatDate,
+		"now":  func() time.Time { return BuildTime },
+		"readFile": func(name string) (string, error) {
+			return ReadFile(path, name)
+		},
 		"relative": func(s string) string {
-			return Relative(filepath.Dir(metadata["url"].(string)), s)
+			rel := Relative(filepath.Dir(metadata["url"].(string)), s)
+			if strings.HasSuffix(s, "/") && rel != "" {
+				rel += "/" // keep pretty URLs pretty
+			}
+			return rel
 		},
 	}
 
-	tmpl, err := template.New(templateName).Funcs(funcMap).Parse(string(input))
+	for name, f := range TemplateFuncs {
+		funcMap[name] = f
+	}
+
+	missingkey := "missingkey=default"
+	if *strict {
+		missingkey = "missingkey=error"
+	}
+
+	var (
+		tmpl interface {
+			Execute(io.Writer, interface{}) error
+		}
+		err error
+	)
+	switch escaper := TemplateEscaper(path); escaper {
+	case "html":
+		tmpl, err = template.New(templateName).Funcs(funcMap).Option(missingkey).Parse(string(input))
+	default:
+		funcMap["raw"] = func(s interface{}) RawText { return RawText(fmt.Sprint(s)) }
+		for name, f := range Escapers {
+			funcMap[name] = f
+		}
+		if escaper == "json" {
+			funcMap["jsonify"] = func(v interface{}) (RawText, error) {
+				js, err := Jsonify(v)
+				return RawText(js), err
+			}
+		}
+		var t *texttemplate.Template
+		t, err = texttemplate.New(templateName).Funcs(texttemplate.FuncMap(funcMap)).Option(missingkey).Parse(string(input))
+		if err == nil && escaper != "" {
+			for _, associated := range t.Templates() {
+				escapeActions(associated.Tree, associated.Tree.Root, escaper)
+			}
+		}
+		tmpl = t
+	}
 	if err != nil {
 		Fatalf("Render Template %s: Parse: %s", path, err)
 	}
 
+	context := map[string]interface{}{}
+	for k, v := range metadata {
+		context[k] = v
+	}
+	if *dataDir != "" {
+		context["data"] = Data
+	}
 	output := bytes.Buffer{}
-	if err = tmpl.Execute(&output, metadata); err != nil {
+	if err = tmpl.Execute(&output, context); err != nil {
+		if source, ok := metadata["source"].(string); ok && *strict {
+			Fatalf("Render Template %s: Execute: %s (metadata layered from %s)", path, err, strings.Join(ConsultedLayers(source), ", "))
+		}
 		Fatalf("Render Template %s: Execute: %s", path, err)
 	}
 
 	return output.Bytes()
 }
 
-func RenderMarkdown(input []byte, htmlBits, extensionBits int) []byte {
+// RenderMarkdown renders the Markdown input as HTML. If links isn't nil, the
+// destination of every link is passed through it, and its first error is
+// returned.
+func RenderMarkdown(input []byte, htmlBits, extensionBits int, links func(string) (string, error)) ([]byte, error) {
 	Debugf("rendering %d byte(s) of Markdown", len(input))
 
 	htmlOptions := htmlBits // default
-	htmlOptions |= blackfriday.HTML_USE_SMARTYPANTS
+	if Markdown.Smartypants {
+		htmlOptions |= blackfriday.HTML_USE_SMARTYPANTS
+	}
 	title, css := "", ""
 	htmlRenderer := blackfriday.HtmlRenderer(htmlOptions, title, css)
+	var refs *refRenderer
+	if links != nil {
+		refs = &refRenderer{Renderer: htmlRenderer, resolve: links}
+		htmlRenderer = refs
+	}
 
 	extensions := extensionBits // default
 	extensions |= blackfriday.EXTENSION_NO_INTRA_EMPHASIS
@@ -257,7 +653,16 @@ func RenderMarkdown(input []byte, htmlBits, extensionBits int) []byte {
 	extensions |= blackfriday.EXTENSION_FOOTNOTES
 	extensions |= blackfriday.EXTENSION_LAX_HTML_BLOCKS
 	extensions |= blackfriday.EXTENSION_HEADER_IDS
-	extensions |= blackfriday.EXTENSION_AUTO_HEADER_IDS
+	if Markdown.HeaderIDs {
+		extensions |= blackfriday.EXTENSION_AUTO_HEADER_IDS
+	}
+	if Markdown.HardLineBreaks {
+		extensions |= blackfriday.EXTENSION_HARD_LINE_BREAK
+	}
 
-	return blackfriday.Markdown(input, htmlRenderer, extensions)
+	output := blackfriday.Markdown(input, htmlRenderer, extensions)
+	if refs != nil && refs.err != nil {
+		return nil, refs.err
+	}
+	return output, nil
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+)
+
+// MergeDirectives are the keys of a map which, as a metadata value, says how
+// to merge it into the value it's layered onto, rather than being merged as a
+// map itself:
+//
+//	{ "tags": { "$append": ["go"] } }     appends to the inherited list
+//	{ "tags": { "$prepend": ["go"] } }    prepends to the inherited list
+//	{ "draft": { "$remove": true } }      removes the inherited key
+//	{ "author": { "$replace": {...} } }   replaces the inherited map, rather
+//	                                      than merging into it
+//
+// If there's nothing inherited, $append and $prepend give the list itself,
+// $replace its value, and $remove nothing at all.
+var MergeDirectives = map[string]bool{"$append": true, "$prepend": true, "$remove": true, "$replace": true}
+
+// MergeMetadata merges src into dst, like mergemap.Merge: values in src
+// replace values in dst, except maps, which are merged recursively, and
+// values which are merge directives, which are applied. Nested maps in dst
+// aren't changed; they're copied. MergeMetadata returns dst.
+func MergeMetadata(dst, src map[string]interface{}) map[string]interface{} {
+	for key, srcVal := range src {
+		dstVal := dst[key]
+		if directive, arg, ok := mergeDirective(srcVal); ok {
+			switch directive {
+			case "$remove":
+				delete(dst, key)
+			case "$replace":
+				dst[key] = resolveDirectives(arg)
+			case "$append", "$prepend":
+				list, ok := arg.([]interface{})
+				if !ok {
+					list = []interface{}{arg}
+				}
+				inherited := []interface{}{} // if it's not a list, it's replaced
+				switch dstVal.(type) {
+				case []interface{}, []string:
+					inherited, _ = Items(dstVal)
+				}
+				if directive == "$append" {
+					dst[key] = append(append([]interface{}{}, inherited...), list...)
+				} else {
+					dst[key] = append(append([]interface{}{}, list...), inherited...)
+				}
+			}
+			continue
+		}
+		srcMap, srcMapOk := mapify(srcVal)
+		dstMap, dstMapOk := mapify(dstVal)
+		switch {
+		case srcMapOk && dstMapOk:
+			srcVal = MergeMetadata(copyMap(dstMap), srcMap)
+		case srcMapOk:
+			srcVal = MergeMetadata(map[string]interface{}{}, srcMap)
+		}
+		dst[key] = srcVal
+	}
+	return dst
+}
+
+// ConflictingKeys returns the keys which src would set to a different value
+// than dst has, if it were merged into dst, in order. Keys in nested maps are
+// joined with dots, and keys src gives merge directives aren't conflicts.
+func ConflictingKeys(dst, src map[string]interface{}) []string {
+	keys := []string{}
+	for key, srcVal := range src {
+		dstVal, ok := dst[key]
+		if _, _, isDirective := mergeDirective(srcVal); !ok || isDirective {
+			continue
+		}
+		srcMap, srcMapOk := mapify(srcVal)
+		dstMap, dstMapOk := mapify(dstVal)
+		switch {
+		case srcMapOk && dstMapOk:
+			for _, nested := range ConflictingKeys(dstMap, srcMap) {
+				keys = append(keys, key+"."+nested)
+			}
+		case !reflect.DeepEqual(dstVal, srcVal):
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// mapify returns v as a map[string]interface{}, if it's any kind of map with
+// string keys, as mergemap does. The map is copied unless it's already one.
+func mapify(v interface{}) (map[string]interface{}, bool) {
+	if m, ok := v.(map[string]interface{}); ok {
+		return m, true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	m := make(map[string]interface{}, rv.Len())
+	for _, k := range rv.MapKeys() {
+		m[k.String()] = rv.MapIndex(k).Interface()
+	}
+	return m, true
+}
+
+// mergeDirective returns the directive and its argument, if v is a map of a
+// single merge directive.
+func mergeDirective(v interface{}) (string, interface{}, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return "", nil, false
+	}
+	for k, arg := range m {
+		if MergeDirectives[k] {
+			return k, arg, true
+		}
+	}
+	return "", nil, false
+}
+
+// resolveDirectives applies the merge directives in v to nothing.
+func resolveDirectives(v interface{}) interface{} {
+	return MergeMetadata(map[string]interface{}{}, map[string]interface{}{"v": v})["v"]
+}
+
+// copyMap copies the top level of m.
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeMetadata(t *testing.T) {
+	for _, tuple := range []struct {
+		dst, src, expected map[string]interface{}
+	}{
+		{
+			map[string]interface{}{"tags": []interface{}{"a"}},
+			map[string]interface{}{"tags": map[string]interface{}{"$append": []interface{}{"b", "c"}}},
+			map[string]interface{}{"tags": []interface{}{"a", "b", "c"}},
+		},
+		{
+			map[string]interface{}{"tags": []string{"a"}},
+			map[string]interface{}{"tags": map[string]interface{}{"$append": "b"}},
+			map[string]interface{}{"tags": []interface{}{"a", "b"}},
+		},
+		{
+			map[string]interface{}{"tags": []interface{}{"a"}},
+			map[string]interface{}{"tags": map[string]interface{}{"$prepend": []interface{}{"b"}}},
+			map[string]interface{}{"tags": []interface{}{"b", "a"}},
+		},
+		{
+			map[string]interface{}{},
+			map[string]interface{}{"tags": map[string]interface{}{"$append": []interface{}{"b"}}},
+			map[string]interface{}{"tags": []interface{}{"b"}},
+		},
+		{
+			map[string]interface{}{"tags": "a"},
+			map[string]interface{}{"tags": map[string]interface{}{"$prepend": []interface{}{"b"}}},
+			map[string]interface{}{"tags": []interface{}{"b"}},
+		},
+		{
+			map[string]interface{}{"draft": true, "title": "x"},
+			map[string]interface{}{"draft": map[string]interface{}{"$remove": true}},
+			map[string]interface{}{"title": "x"},
+		},
+		{
+			map[string]interface{}{},
+			map[string]interface{}{"draft": map[string]interface{}{"$remove": true}},
+			map[string]interface{}{},
+		},
+		{
+			map[string]interface{}{"author": map[string]interface{}{"name": "Jane", "email": "jane@example.com"}},
+			map[string]interface{}{"author": map[string]interface{}{"$replace": map[string]interface{}{"name": "Joe"}}},
+			map[string]interface{}{"author": map[string]interface{}{"name": "Joe"}},
+		},
+		{
+			map[string]interface{}{"author": map[string]interface{}{"name": "Jane", "email": "jane@example.com"}},
+			map[string]interface{}{"author": map[string]interface{}{"name": "Joe"}},
+			map[string]interface{}{"author": map[string]interface{}{"name": "Joe", "email": "jane@example.com"}},
+		},
+		{
+			map[string]interface{}{"nav": map[string]interface{}{"links": []interface{}{"/"}, "home": "/"}},
+			map[string]interface{}{"nav": map[string]interface{}{
+				"links": map[string]interface{}{"$append": "/about"},
+				"home":  map[string]interface{}{"$remove": true},
+			}},
+			map[string]interface{}{"nav": map[string]interface{}{"links": []interface{}{"/", "/about"}}},
+		},
+		{
+			map[string]interface{}{},
+			map[string]interface{}{"nav": map[string]interface{}{"links": map[string]interface{}{"$append": "/about"}}},
+			map[string]interface{}{"nav": map[string]interface{}{"links": []interface{}{"/about"}}},
+		},
+		{
+			// Not a directive: it has more than one key.
+			map[string]interface{}{"x": map[string]interface{}{"a": 1}},
+			map[string]interface{}{"x": map[string]interface{}{"$append": 2, "b": 3}},
+			map[string]interface{}{"x": map[string]interface{}{"a": 1, "$append": 2, "b": 3}},
+		},
+	} {
+		if got := MergeMetadata(tuple.dst, tuple.src); !reflect.DeepEqual(tuple.expected, got) {
+			t.Errorf("%v + %v: expected %v, got %v", tuple.dst, tuple.src, tuple.expected, got)
+		}
+	}
+}
+
+func TestMergeMetadataCopiesNestedMaps(t *testing.T) {
+	inherited := map[string]interface{}{"a": 1}
+	dst := map[string]interface{}{"nav": inherited}
+	MergeMetadata(dst, map[string]interface{}{"nav": map[string]interface{}{"b": 2}})
+	if !reflect.DeepEqual(map[string]interface{}{"a": 1}, inherited) {
+		t.Errorf("nested map changed: %v", inherited)
+	}
+}
+
+func TestConflictingKeys(t *testing.T) {
+	dst := map[string]interface{}{
+		"title":  "A",
+		"layout": "page",
+		"tags":   []interface{}{"a"},
+		"author": map[string]interface{}{"name": "Jane", "email": "jane@example.com"},
+	}
+	src := map[string]interface{}{
+		"title":  "B",
+		"layout": "page",
+		"tags":   map[string]interface{}{"$append": "b"},
+		"author": map[string]interface{}{"name": "Joe", "url": "http://joe.example.com"},
+		"draft":  true,
+	}
+	expected := []string{"author.name", "title"}
+	if got := ConflictingKeys(dst, src); !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
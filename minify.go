@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Minifiers map target file extensions to the function which minifies them.
+// They're deliberately conservative: they remove comments and insignificant
+// whitespace, and nothing else.
+var Minifiers = map[string]func([]byte) ([]byte, error){
+	".css":  MinifyCSS,
+	".js":   MinifyJS,
+	".json": MinifyJSON,
+	".svg":  MinifySVG,
+	".html": MinifyHTML,
+}
+
+// Minify minifies buf according to the extension of filename, if there's a
+// Minifier for it. If minification fails, Minify warns and returns buf as-is.
+func Minify(filename string, buf []byte) []byte {
+	minifier, ok := Minifiers[filepath.Ext(filename)]
+	if !ok {
+		return buf
+	}
+	minified, err := minifier(buf)
+	if err != nil {
+		Warningf("%s: not minified: %s", filename, err)
+		return buf
+	}
+	Debugf("%s minified from %d to %d byte(s)", filename, len(buf), len(minified))
+	return minified
+}
+
+// WriteOutput writes buf to the target file, minifying it first if the
+// -minify flag is set.
+func WriteOutput(tgt string, buf []byte) {
+	if *minify {
+		buf = Minify(tgt, buf)
+	}
+	Write(tgt, buf)
+}
+
+// MinifyJSON removes insignificant whitespace from JSON.
+func MinifyJSON(buf []byte) ([]byte, error) {
+	out := bytes.Buffer{}
+	if err := json.Compact(&out, buf); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// MinifyCSS removes comments and insignificant whitespace from CSS. Space
+// around the colon of a declaration is insignificant, but not around the colon
+// of a selector: "a :hover" isn't "a:hover".
+func MinifyCSS(buf []byte) ([]byte, error) {
+	const tight = "{};,>"
+	out := bytes.Buffer{}
+	space, depth, colon := false, 0, false // colon: the last byte is a declaration's colon
+	for i := 0; i < len(buf); i++ {
+		c := buf[i]
+		switch {
+		case c == '/' && i+1 < len(buf) && buf[i+1] == '*':
+			end := bytes.Index(buf[i+2:], []byte("*/"))
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += 2 + end + 1
+			space = true
+
+		case isSpace(c):
+			space = true
+
+		default:
+			last := lastByte(&out)
+			declarationColon := c == ':' && depth > 0 && inDeclaration(buf, i)
+			if space && last != 0 && strings.IndexByte(tight, last) < 0 && strings.IndexByte(tight, c) < 0 && !colon && !declarationColon {
+				out.WriteByte(' ')
+			}
+			space, colon = false, declarationColon
+			if c == '}' && last == ';' {
+				out.Truncate(out.Len() - 1)
+			}
+			switch c {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			}
+			if c == '"' || c == '\'' {
+				i = copyQuoted(&out, buf, i)
+				continue
+			}
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// inDeclaration reports whether buf[i], inside a block, is part of a
+// declaration rather than a nested rule's selector: whether a ";" or "}"
+// comes before the next "{".
+func inDeclaration(buf []byte, i int) bool {
+	for ; i < len(buf); i++ {
+		switch buf[i] {
+		case ';', '}':
+			return true
+		case '{':
+			return false
+		case '"', '\'':
+			i = copyQuoted(&bytes.Buffer{}, buf, i)
+		}
+	}
+	return true
+}
+
+// MinifyJS removes comments and insignificant whitespace from JavaScript.
+// Line breaks are kept (collapsed), so automatic semicolon insertion behaves
+// just as it did before.
+func MinifyJS(buf []byte) ([]byte, error) {
+	out := bytes.Buffer{}
+	space, newline := false, false
+	flush := func(next byte) {
+		last := lastByte(&out)
+		switch {
+		case last == 0:
+		case newline && last != '\n':
+			out.WriteByte('\n')
+		case space && (isWord(last) && isWord(next) || last == next && (last == '+' || last == '-' || last == '/')):
+			out.WriteByte(' ')
+		}
+		space, newline = false, false
+	}
+	for i := 0; i < len(buf); i++ {
+		c := buf[i]
+		switch {
+		case c == '/' && i+1 < len(buf) && buf[i+1] == '/':
+			for i < len(buf) && buf[i] != '\n' {
+				i++
+			}
+			newline = true
+
+		case c == '/' && i+1 < len(buf) && buf[i+1] == '*':
+			end := bytes.Index(buf[i+2:], []byte("*/"))
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			if bytes.IndexByte(buf[i:i+2+end], '\n') >= 0 {
+				newline = true
+			}
+			i += 2 + end + 1
+			space = true
+
+		case c == '\n':
+			newline = true
+
+		case isSpace(c):
+			space = true
+
+		case c == '"' || c == '\'' || c == '`':
+			flush(c)
+			i = copyQuoted(&out, buf, i)
+
+		case c == '/' && regexpMayFollow(out.Bytes()):
+			flush(c)
+			i = copyRegexp(&out, buf, i)
+
+		default:
+			flush(c)
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// MinifySVG removes comments and whitespace between tags from SVG.
+func MinifySVG(buf []byte) ([]byte, error) {
+	return minifyMarkup(buf, true), nil
+}
+
+// MinifyHTML removes comments and collapses whitespace in HTML, leaving the
+// contents of pre and textarea elements alone. Inline scripts and styles are
+// minified, too.
+func MinifyHTML(buf []byte) ([]byte, error) {
+	return minifyMarkup(buf, false), nil
+}
+
+// rawElements are HTML elements whose content isn't markup.
+var rawElements = []string{"pre", "textarea", "script", "style"}
+
+func minifyMarkup(buf []byte, xml bool) []byte {
+	out := bytes.Buffer{}
+	space, inTag, tagStart := false, false, 0
+	for i := 0; i < len(buf); i++ {
+		c := buf[i]
+		switch {
+		case !inTag && bytes.HasPrefix(buf[i:], []byte("<!--")) && !bytes.HasPrefix(buf[i:], []byte("<!--[if")):
+			end := bytes.Index(buf[i+4:], []byte("-->"))
+			if end < 0 {
+				return out.Bytes()
+			}
+			i += 4 + end + 2
+
+		case !inTag && bytes.HasPrefix(buf[i:], []byte("<![CDATA[")):
+			end := bytes.Index(buf[i:], []byte("]]>"))
+			if end < 0 {
+				end = len(buf) - i - 3
+			}
+			if space && !(xml && lastByte(&out) == '>') {
+				out.WriteByte(' ')
+			}
+			space = false
+			out.Write(buf[i : i+end+3])
+			i += end + 2
+
+		case isSpace(c):
+			space = true
+
+		case inTag && (c == '"' || c == '\''):
+			if space {
+				out.WriteByte(' ')
+				space = false
+			}
+			end := bytes.IndexByte(buf[i+1:], c)
+			if end < 0 {
+				end = len(buf) - i - 1
+			}
+			out.Write(buf[i : i+1+end+1])
+			i += end + 1
+
+		default:
+			last := lastByte(&out)
+			switch {
+			case !space || last == 0:
+			case inTag && (c == '>' || c == '/' || c == '=' || last == '='):
+			case !inTag && xml && last == '>' && c == '<':
+			default:
+				out.WriteByte(' ')
+			}
+			space = false
+			out.WriteByte(c)
+
+			switch {
+			case c == '<' && !inTag && i+1 < len(buf) && startsTag(buf[i+1]):
+				inTag, tagStart = true, out.Len()-1
+			case c == '>' && inTag:
+				inTag = false
+				if xml {
+					continue
+				}
+				tag := out.Bytes()[tagStart:]
+				if name, opening := tagName(tag); opening {
+					for _, raw := range rawElements {
+						if name == raw {
+							i = copyRawElement(&out, buf, i+1, name, tag) - 1
+							break
+						}
+					}
+				}
+			}
+		}
+	}
+	return bytes.TrimSpace(out.Bytes())
+}
+
+// copyRawElement copies the content of the raw element name, which starts at
+// buf[i], to out, minifying it if it's a script or style. It returns the index
+// of the element's closing tag.
+func copyRawElement(out *bytes.Buffer, buf []byte, i int, name string, tag []byte) int {
+	end := bytes.Index(bytes.ToLower(buf[i:]), []byte("</"+name))
+	if end < 0 {
+		end = len(buf) - i
+	}
+	content := buf[i : i+end]
+	minified, err := content, error(nil)
+	switch tag := strings.ToLower(string(tag)); name {
+	case "style":
+		minified, err = MinifyCSS(content)
+	case "script":
+		switch {
+		case !strings.Contains(tag, "type="), strings.Contains(tag, "javascript"), strings.Contains(tag, "module"):
+			minified, err = MinifyJS(content)
+		case strings.Contains(tag, "json"):
+			minified, err = MinifyJSON(content)
+		}
+	}
+	if err != nil {
+		minified = content
+	}
+	out.Write(minified)
+	return i + end
+}
+
+// tagName returns the lowercased name of the tag, and whether it's an opening
+// tag.
+func tagName(tag []byte) (string, bool) {
+	if len(tag) < 2 || tag[1] == '/' || tag[1] == '!' || bytes.HasSuffix(tag, []byte("/>")) {
+		return "", false
+	}
+	name := tag[1:]
+	if end := bytes.IndexAny(name, " \t\r\n/>"); end >= 0 {
+		name = name[:end]
+	}
+	return strings.ToLower(string(name)), true
+}
+
+// copyQuoted copies the string literal starting at buf[i] to out, and returns
+// the index of its closing quote.
+func copyQuoted(out *bytes.Buffer, buf []byte, i int) int {
+	quote := buf[i]
+	out.WriteByte(quote)
+	for i++; i < len(buf); i++ {
+		out.WriteByte(buf[i])
+		switch buf[i] {
+		case '\\':
+			if i+1 < len(buf) {
+				i++
+				out.WriteByte(buf[i])
+			}
+		case quote:
+			return i
+		}
+	}
+	return i
+}
+
+// copyRegexp copies the JavaScript regular expression literal starting at
+// buf[i] to out, and returns the index of its closing slash.
+func copyRegexp(out *bytes.Buffer, buf []byte, i int) int {
+	out.WriteByte('/')
+	class := false
+	for i++; i < len(buf); i++ {
+		out.WriteByte(buf[i])
+		switch buf[i] {
+		case '\\':
+			if i+1 < len(buf) {
+				i++
+				out.WriteByte(buf[i])
+			}
+		case '[':
+			class = true
+		case ']':
+			class = false
+		case '/':
+			if !class {
+				return i
+			}
+		case '\n':
+			return i // not a regexp after all
+		}
+	}
+	return i
+}
+
+// regexpMayFollow reports whether a '/' following the already-minified
+// JavaScript in buf begins a regular expression, rather than a division.
+func regexpMayFollow(buf []byte) bool {
+	buf = bytes.TrimRight(buf, " \n")
+	if len(buf) == 0 {
+		return true
+	}
+	if last := buf[len(buf)-1]; !isWord(last) {
+		return last != ')' && last != ']' && last != '}'
+	}
+	start := len(buf)
+	for start > 0 && isWord(buf[start-1]) {
+		start--
+	}
+	switch string(buf[start:]) {
+	case "return", "typeof", "case", "do", "else", "in", "of", "new", "delete", "void", "throw", "instanceof", "yield", "await":
+		return true
+	}
+	return false
+}
+
+func lastByte(buf *bytes.Buffer) byte {
+	if b := buf.Bytes(); len(b) > 0 {
+		return b[len(b)-1]
+	}
+	return 0
+}
+
+func startsTag(c byte) bool {
+	return c == '/' || c == '!' || c == '?' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isWord(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
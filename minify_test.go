@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMinifyCSS(t *testing.T) {
+	for input, expected := range map[string]string{
+		"a { color: red; }":                                  "a{color:red}",
+		"a { color : red ; }":                                "a{color:red}",
+		"/* c */\nh1 ,\nh2 > p {\n  margin : 0 ;\n}\n":       "h1,h2>p{margin:0}",
+		`a::after { content: "  /* x */  "; }`:               `a::after{content:"  /* x */  "}`,
+		"a :hover { width: calc(1px + 2em) }":                "a :hover{width:calc(1px + 2em)}",
+		"@media (min-width: 600px) { a :hover { top : 0 } }": "@media (min-width: 600px){a :hover{top:0}}",
+		`a { background : url("x;y.png") }`:                  `a{background:url("x;y.png")}`,
+	} {
+		got, err := MinifyCSS([]byte(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected != string(got) {
+			t.Errorf("%q: expected %q, got %q", input, expected, string(got))
+		}
+	}
+
+	input := []byte("a { color: red; }\n/* unterminated\nb { color: blue; }")
+	if _, err := MinifyCSS(input); err == nil {
+		t.Errorf("unterminated comment: expected error, got none")
+	}
+	if got := Minify("style.css", input); string(input) != string(got) {
+		t.Errorf("unterminated comment: expected %q untouched, got %q", input, got)
+	}
+}
+
+func TestMinifyJS(t *testing.T) {
+	for input, expected := range map[string]string{
+		"var a = 1;  // one\nvar b = 2;":                       "var a=1;\nvar b=2;",
+		"/* header */\nfunction f ( x ) {\n\treturn x / 2;\n}": "function f(x){\nreturn x/2;\n}",
+		`var s = "a // b"; var r = /\/\/[a/]/g;`:               `var s="a // b";var r=/\/\/[a/]/g;`,
+		"a = b + +c; d = e - -f":                               "a=b+ +c;d=e- -f",
+		"x = `  ${y}  // z  `":                                 "x=`  ${y}  // z  `",
+		"return /re/.test(s)":                                  "return/re/.test(s)",
+	} {
+		got, err := MinifyJS([]byte(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected != string(got) {
+			t.Errorf("%q: expected %q, got %q", input, expected, string(got))
+		}
+	}
+}
+
+func TestMinifyJSON(t *testing.T) {
+	got, err := MinifyJSON([]byte("{\n  \"a\": [1, 2],\n  \"b\": \"x y\"\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"a":[1,2],"b":"x y"}`; expected != string(got) {
+		t.Errorf("expected %q, got %q", expected, string(got))
+	}
+
+	if _, err := MinifyJSON([]byte("{")); err == nil {
+		t.Errorf("expected error, got none")
+	}
+}
+
+func TestMinifyHTML(t *testing.T) {
+	for input, expected := range map[string]string{
+		"<p>\n  Hello,   <b>world</b>\n</p>\n":          "<p> Hello, <b>world</b> </p>",
+		"<!-- comment --><p title=\"a  b\" >x</p>":      `<p title="a  b">x</p>`,
+		"<pre>\n  keep   this\n</pre>":                  "<pre>\n  keep   this\n</pre>",
+		"<style>\n a { color : red ; }\n</style>":       "<style>a{color:red}</style>",
+		"<script>\n  var a = 1; // x\n</script>":        "<script>var a=1;</script>",
+		"<script type=\"text/template\">  x  </script>": "<script type=\"text/template\">  x  </script>",
+		"<!--[if IE]><p>IE</p><![endif]-->":             "<!--[if IE]><p>IE</p><![endif]-->",
+		"<p>1 < 2</p>":                                  "<p>1 < 2</p>",
+	} {
+		got, err := MinifyHTML([]byte(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected != string(got) {
+			t.Errorf("%q: expected %q, got %q", input, expected, string(got))
+		}
+	}
+}
+
+func TestMinifySVG(t *testing.T) {
+	input := "<?xml version=\"1.0\"?>\n<!-- c -->\n<svg xmlns=\"http://www.w3.org/2000/svg\">\n  <g>\n    <text>a  b</text>\n  </g>\n</svg>\n"
+	expected := "<?xml version=\"1.0\"?><svg xmlns=\"http://www.w3.org/2000/svg\"><g><text>a b</text></g></svg>"
+	got, err := MinifySVG([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected != string(got) {
+		t.Errorf("expected %q, got %q", expected, string(got))
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	PermalinkTokenRegexp = regexp.MustCompile(`:[A-Za-z_][A-Za-z0-9_]*`)
+)
+
+// Permalink expands the permalink pattern for the source file at path, and
+// returns the target filename and the URL under which it will be served.
+//
+// Patterns may contain the tokens :year, :month and :day (taken from the
+// "date" metadata key), :slug, :filename (the source filename without its
+// extension) and :path (the directory of the source file, relative to the
+// source directory). Any other token :key is replaced by the string or number
+// under key in the metadata, which mustn't contain a "/". A pattern beginning
+// with "/" is relative to the target directory; otherwise, it's relative to
+// the target directory corresponding to the source file's directory, just
+// like the "template" key. A pattern ending in "/" yields a "pretty" URL: the
+// target is index.html in that directory, and the URL is the directory
+// itself. A pattern whose last element has no extension is given targetExt.
+func Permalink(pattern, path, slug, targetExt string, metadata map[string]interface{}) (string, string, error) {
+	var err error
+	expanded := PermalinkTokenRegexp.ReplaceAllStringFunc(pattern, func(token string) string {
+		date, dated := metadata["date"].(time.Time)
+		switch token {
+		case ":year", ":month", ":day":
+			if !dated {
+				err = fmt.Errorf("permalink %q: %s requires a date", pattern, token)
+				return ""
+			}
+		}
+		switch token {
+		case ":year":
+			return fmt.Sprintf("%04d", date.Year())
+		case ":month":
+			return fmt.Sprintf("%02d", date.Month())
+		case ":day":
+			return fmt.Sprintf("%02d", date.Day())
+		case ":slug":
+			return slug
+		case ":filename":
+			base := filepath.Base(path)
+			return base[:len(base)-len(filepath.Ext(base))]
+		case ":path":
+			return filepath.ToSlash(Relative(*sourceDir, filepath.Dir(path)))
+		}
+		switch v := metadata[token[1:]].(type) {
+		case string:
+			if v != "" && !strings.ContainsAny(v, "/\\") {
+				return v
+			}
+			err = fmt.Errorf("permalink %q: bad value %q for %s", pattern, v, token)
+			return ""
+		case float64, int, int64:
+			return fmt.Sprint(v)
+		}
+		err = fmt.Errorf("permalink %q: unknown token %s", pattern, token)
+		return ""
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	baseDir := *targetDir
+	if !strings.HasPrefix(expanded, "/") {
+		baseDir = filepath.Join(*targetDir, Relative(*sourceDir, filepath.Dir(path)))
+	}
+
+	var target, url string
+	if strings.HasSuffix(expanded, "/") {
+		dir := filepath.Join(baseDir, filepath.FromSlash(expanded))
+		target = filepath.Join(dir, "index.html")
+		url = "/" + filepath.ToSlash(Relative(*targetDir, dir))
+		if !strings.HasSuffix(url, "/") {
+			url += "/"
+		}
+	} else {
+		target = filepath.Join(baseDir, filepath.FromSlash(expanded))
+		if filepath.Ext(target) == "" {
+			target += targetExt
+		}
+		url = "/" + filepath.ToSlash(Relative(*targetDir, target))
+	}
+	if !strings.HasPrefix(target, *targetDir+string(filepath.Separator)) {
+		return "", "", fmt.Errorf("permalink %q: %s is outside of the target directory", pattern, target)
+	}
+	return target, url, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPermalink(t *testing.T) {
+	var (
+		path     = *sourceDir + "/blog/2013-01-02-first-entry.md"
+		metadata = map[string]interface{}{"date": time.Date(2013, 1, 2, 0, 0, 0, 0, time.UTC)}
+	)
+	type tuple struct{ target, url string }
+	for pattern, expected := range map[string]tuple{
+		"/:year/:month/:slug/":      tuple{*targetDir + "/2013/01/first-entry/index.html", "/2013/01/first-entry/"},
+		"/posts/:slug/index.html":   tuple{*targetDir + "/posts/first-entry/index.html", "/posts/first-entry/index.html"},
+		":year/:day/:slug":          tuple{*targetDir + "/blog/2013/02/first-entry.html", "/blog/2013/02/first-entry.html"},
+		"/:path/:filename.htm":      tuple{*targetDir + "/blog/2013-01-02-first-entry.htm", "/blog/2013-01-02-first-entry.htm"},
+		"./":                        tuple{*targetDir + "/blog/index.html", "/blog/"},
+		"/":                         tuple{*targetDir + "/index.html", "/"},
+		"/archive/:year/:slug.html": tuple{*targetDir + "/archive/2013/first-entry.html", "/archive/2013/first-entry.html"},
+	} {
+		target, url, err := Permalink(pattern, path, "first-entry", ".html", metadata)
+		if err != nil {
+			t.Errorf("%q: %s", pattern, err)
+			continue
+		}
+		if expected.target != target {
+			t.Errorf("%q: expected target %s, got %s", pattern, expected.target, target)
+		}
+		if expected.url != url {
+			t.Errorf("%q: expected URL %s, got %s", pattern, expected.url, url)
+		}
+	}
+
+	for _, pattern := range []string{"/:bogus/", "/../:slug", "../../:slug"} {
+		if _, _, err := Permalink(pattern, path, "first-entry", ".html", metadata); err == nil {
+			t.Errorf("%q: expected error, got none", pattern)
+		}
+	}
+
+	fields := map[string]interface{}{"name": "launch", "id": 7.0, "bad": "a/b"}
+	if target, _, err := Permalink("/events/:id-:name/", path, "first-entry", ".html", fields); err != nil || target != *targetDir+"/events/7-launch/index.html" {
+		t.Errorf("metadata tokens: got %s (%v)", target, err)
+	}
+	if _, _, err := Permalink("/:bad/", path, "first-entry", ".html", fields); err == nil {
+		t.Errorf("expected error for a value containing /, got none")
+	}
+
+	if _, _, err := Permalink("/:year/:slug", path, "first-entry", ".html", map[string]interface{}{}); err == nil {
+		t.Errorf("expected error for :year without a date, got none")
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"time"
+)
+
+var (
+	// BuildTime is the moment against which publish and expiry dates are
+	// compared. It's fixed for the duration of a build.
+	BuildTime = time.Now()
+)
+
+// Publishable reports whether a file with the given metadata should be
+// rendered into the target directory and listed in the Global Key. If it
+// shouldn't, the returned string explains why.
+//
+// Drafts ("draft": true) are held back unless includeDrafts is set. Files
+// with a "publishDate" (or, failing that, a "date") after BuildTime are held
+// back unless includeFuture is set. Files with an "expiryDate" at or before
+// BuildTime are held back unless includeExpired is set.
+func Publishable(metadata map[string]interface{}, includeDrafts, includeFuture, includeExpired bool) (bool, string) {
+	if draft, _ := metadata["draft"].(bool); draft && !includeDrafts {
+		return false, "draft"
+	}
+
+	publishDate, ok := metadata["publishDate"].(time.Time)
+	if !ok {
+		publishDate, ok = metadata["date"].(time.Time)
+	}
+	if ok && publishDate.After(BuildTime) && !includeFuture {
+		return false, "future-dated " + publishDate.Format(time.RFC3339)
+	}
+
+	if expiryDate, ok := metadata["expiryDate"].(time.Time); ok && !expiryDate.After(BuildTime) && !includeExpired {
+		return false, "expired " + expiryDate.Format(time.RFC3339)
+	}
+
+	return true, ""
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPublishable(t *testing.T) {
+	var (
+		past   = BuildTime.Add(-24 * time.Hour)
+		future = BuildTime.Add(24 * time.Hour)
+	)
+
+	type flags struct{ drafts, future, expired bool }
+	for _, tu := range []struct {
+		metadata map[string]interface{}
+		flags    flags
+		expected bool
+	}{
+		{map[string]interface{}{}, flags{}, true},
+		{map[string]interface{}{"draft": false}, flags{}, true},
+		{map[string]interface{}{"draft": true}, flags{}, false},
+		{map[string]interface{}{"draft": true}, flags{drafts: true}, true},
+		{map[string]interface{}{"date": past}, flags{}, true},
+		{map[string]interface{}{"date": future}, flags{}, false},
+		{map[string]interface{}{"date": future}, flags{future: true}, true},
+		{map[string]interface{}{"date": future, "publishDate": past}, flags{}, true},
+		{map[string]interface{}{"date": past, "publishDate": future}, flags{}, false},
+		{map[string]interface{}{"expiryDate": future}, flags{}, true},
+		{map[string]interface{}{"expiryDate": past}, flags{}, false},
+		{map[string]interface{}{"expiryDate": past}, flags{expired: true}, true},
+		{map[string]interface{}{"draft": true, "date": future}, flags{drafts: true}, false},
+	} {
+		got, reason := Publishable(tu.metadata, tu.flags.drafts, tu.flags.future, tu.flags.expired)
+		if tu.expected != got {
+			t.Errorf("%v %+v: expected %v, got %v (%s)", tu.metadata, tu.flags, tu.expected, got, reason)
+		}
+	}
+}
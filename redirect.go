@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Redirect is a single redirect from an old URL to the URL of a page.
+type Redirect struct {
+	From   string // URL
+	To     string // URL
+	Source string // source file of the page redirected to
+	Alias  bool   // declared in "aliases", rather than generated
+}
+
+// AliasURLs converts the "aliases" metadata value of the source file at
+// filename into a list of absolute URLs. Relative aliases are resolved against
+// the URL of the source file's directory.
+func AliasURLs(filename string, i interface{}) []string {
+	list, ok := toStrings(i)
+	if !ok {
+		Fatalf("%s: aliases must be a list of strings, not %v", filename, i)
+	}
+	baseURL := "/" + filepath.ToSlash(Relative(*sourceDir, filepath.Dir(filename)))
+	urls := []string{}
+	for _, alias := range list {
+		url := alias
+		if !strings.HasPrefix(url, "/") {
+			url = path.Join(baseURL, url)
+		}
+		url = path.Clean(url)
+		if strings.HasSuffix(alias, "/") && url != "/" {
+			url += "/"
+		}
+		urls = append(urls, url)
+	}
+	return urls
+}
+
+// RedirectFile returns the file in the target directory that serves the
+// redirect stub for the given URL. URLs ending in "/", or without an
+// extension, are served by an index.html in that directory.
+func RedirectFile(url string) string {
+	file := filepath.Join(*targetDir, filepath.FromSlash(url))
+	if strings.HasSuffix(url, "/") || path.Ext(url) == "" {
+		file = filepath.Join(file, "index.html")
+	}
+	return file
+}
+
+// GatherRedirects collects the aliases and generated redirects of every page
+// in targets (target: source), ordered by From URL. An alias that would
+// overwrite a page, or another alias, is fatal. A generated redirect that
+// would overwrite a page, an alias or another generated redirect is skipped
+// with a warning.
+//
+// Redirects may not overwrite anything else in targets, either.
+func GatherRedirects(s StackReader, targets map[string]string) []Redirect {
+	Debugf("gathering redirects")
+	sources := []string{}
+	for _, source := range targets {
+		switch filepath.Ext(source) {
+		case ".html", ".md":
+			sources = append(sources, source) // only pages have redirects
+		}
+	}
+	sort.Strings(sources)
+
+	claimed := map[string]Redirect{} // redirect file: redirect
+	for _, alias := range []bool{true, false} {
+		key := "redirects"
+		if alias {
+			key = "aliases"
+		}
+		for _, source := range sources {
+			metadata := s.Get(source)
+			to, _ := metadata["url"].(string)
+			froms, _ := toStrings(metadata[key])
+			for _, from := range froms {
+				r := Redirect{From: from, To: to, Source: source, Alias: alias}
+				file := RedirectFile(from)
+				if page, ok := targets[file]; ok {
+					if alias {
+						Fatalf("%s: alias %s collides with %s", source, from, page)
+					}
+					Warningf("%s: redirect from %s would overwrite %s; skipping", source, from, page)
+					continue
+				}
+				if other, ok := claimed[file]; ok {
+					if other.Source == source {
+						continue // e.g. an alias which duplicates a generated redirect
+					}
+					if alias {
+						Fatalf("%s: alias %s collides with alias %s of %s", source, from, other.From, other.Source)
+					}
+					Warningf("%s: redirect from %s collides with %s of %s; skipping", source, from, other.From, other.Source)
+					continue
+				}
+				claimed[file] = r
+			}
+		}
+	}
+
+	redirects := []Redirect{}
+	for _, r := range claimed {
+		redirects = append(redirects, r)
+	}
+	sort.Sort(redirectsByFrom(redirects))
+	return redirects
+}
+
+// WriteRedirects writes an http-equiv refresh stub for every redirect.
+func WriteRedirects(redirects []Redirect) {
+	for _, r := range redirects {
+		file := RedirectFile(r.From)
+		Write(file, RedirectTo(r.To))
+		Debugf("redirect %s written to %s", r.From, file)
+	}
+}
+
+// RedirectMap describes a server-side redirect configuration format.
+type RedirectMap struct {
+	Filename string // relative to the target directory
+	Render   func([]Redirect) []byte
+}
+
+// RedirectMaps are the formats selectable with the -redirects flag.
+var RedirectMaps = map[string]RedirectMap{
+	"netlify": {"_redirects", RenderNetlifyRedirects},
+	"nginx":   {"redirects.nginx.conf", RenderNginxRedirects},
+	"apache":  {".htaccess", RenderApacheRedirects},
+}
+
+// WriteRedirectMaps writes every redirect, in each of the named formats, to
+// the target directory.
+func WriteRedirectMaps(redirects []Redirect, formats []string) {
+	for _, format := range formats {
+		redirectMap, ok := RedirectMaps[format]
+		if !ok {
+			Fatalf("unknown redirect map format %q", format)
+		}
+		file := filepath.Join(*targetDir, redirectMap.Filename)
+		Write(file, redirectMap.Render(withDirectoryForms(redirects)))
+		Debugf("%d %s redirect(s) written to %s", len(redirects), format, file)
+	}
+}
+
+// RenderNetlifyRedirects renders a Netlify _redirects file. Its fields are
+// separated by whitespace, so URLs are percent-encoded.
+func RenderNetlifyRedirects(redirects []Redirect) []byte {
+	buf := bytes.Buffer{}
+	buf.WriteString("# Generated by grender.\n")
+	for _, r := range redirects {
+		fmt.Fprintf(&buf, "%s %s 301\n", escapeRedirectURL(r.From), escapeRedirectURL(r.To))
+	}
+	return buf.Bytes()
+}
+
+// RenderNginxRedirects renders an nginx map from old URL to new URL, for
+// inclusion in the http block. Servers use it like so:
+//
+//	if ($grender_redirect) { return 301 $grender_redirect; }
+func RenderNginxRedirects(redirects []Redirect) []byte {
+	buf := bytes.Buffer{}
+	buf.WriteString("# Generated by grender. Include in the http block, and add\n")
+	buf.WriteString("#   if ($grender_redirect) { return 301 $grender_redirect; }\n")
+	buf.WriteString("# to the server block.\n")
+	buf.WriteString("map $uri $grender_redirect {\n")
+	for _, r := range redirects {
+		fmt.Fprintf(&buf, "\t%s %s;\n", quoteRedirectURL(r.From), quoteRedirectURL(r.To))
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+// RenderApacheRedirects renders an Apache .htaccess file. Redirect matches
+// URLs by prefix, so that a redirect from a directory would catch everything
+// in it; RedirectMatch, anchored at both ends, matches only the URL itself.
+func RenderApacheRedirects(redirects []Redirect) []byte {
+	buf := bytes.Buffer{}
+	buf.WriteString("# Generated by grender.\n")
+	for _, r := range redirects {
+		from := "^" + regexp.QuoteMeta(r.From) + "$"
+		to := strings.Replace(escapeRedirectURL(r.To), "$", "%24", -1) // not a backreference
+		fmt.Fprintf(&buf, "RedirectMatch 301 %s %s\n", quoteApacheArgument(from), to)
+	}
+	return buf.Bytes()
+}
+
+// withDirectoryForms returns the redirects, plus a copy of every redirect from
+// an index.html which redirects from its directory instead. Stubs are served
+// for both URLs, so server-side maps should cover both, too.
+func withDirectoryForms(redirects []Redirect) []Redirect {
+	all := []Redirect{}
+	for _, r := range redirects {
+		all = append(all, r)
+		if path.Base(r.From) == "index.html" {
+			r.From = strings.TrimSuffix(r.From, "index.html")
+			all = append(all, r)
+		}
+	}
+	return all
+}
+
+// quoteRedirectURL double-quotes url if it contains characters which nginx or
+// Apache would otherwise misinterpret.
+func quoteRedirectURL(url string) string {
+	if strings.ContainsAny(url, " \t\";{}#") {
+		return fmt.Sprintf("%q", url)
+	}
+	return url
+}
+
+// quoteApacheArgument double-quotes s if it contains whitespace or quotes.
+// Apache only unescapes quotes in quoted arguments, so backslashes, as in
+// regular expressions, are left alone.
+func quoteApacheArgument(s string) string {
+	if strings.ContainsAny(s, " \t\"") {
+		return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+	}
+	return s
+}
+
+// escapeRedirectURL percent-encodes the URL path p.
+func escapeRedirectURL(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
+
+type redirectsByFrom []Redirect
+
+func (a redirectsByFrom) Len() int           { return len(a) }
+func (a redirectsByFrom) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a redirectsByFrom) Less(i, j int) bool { return a[i].From < a[j].From }
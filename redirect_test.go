@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestAliasURLs(t *testing.T) {
+	filename := *sourceDir + "/blog/2013-01-02-first-entry.md"
+	aliases := []interface{}{"/old/first.html", "first/", "../top", "/legacy/"}
+	expected := []string{"/old/first.html", "/blog/first/", "/top", "/legacy/"}
+
+	got := AliasURLs(filename, aliases)
+	if len(expected) != len(got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if expected[i] != got[i] {
+			t.Errorf("%d: expected %s, got %s", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestRedirectFile(t *testing.T) {
+	for url, expected := range map[string]string{
+		"/a/b.html": *targetDir + "/a/b.html",
+		"/a/b/":     *targetDir + "/a/b/index.html",
+		"/a/b":      *targetDir + "/a/b/index.html",
+		"/":         *targetDir + "/index.html",
+	} {
+		if got := RedirectFile(url); expected != got {
+			t.Errorf("%s: expected %s, got %s", url, expected, got)
+		}
+	}
+}
+
+func TestGatherRedirects(t *testing.T) {
+	s := NewStack()
+	s.Add("/src/a.md", map[string]interface{}{
+		"url":       "/a.html",
+		"redirects": []string{"/old-a.html", "/b.html"},
+		"aliases":   []string{"/older-a/"},
+	})
+	s.Add("/src/b.md", map[string]interface{}{
+		"url":       "/b.html",
+		"redirects": []string{"/old-a.html"},
+	})
+	targets := map[string]string{
+		*targetDir + "/a.html": "/src/a.md",
+		*targetDir + "/b.html": "/src/b.md",
+	}
+
+	// "/b.html" is a page, and "/old-a.html" is claimed by a.md first.
+	expected := []Redirect{
+		{From: "/old-a.html", To: "/a.html", Source: "/src/a.md"},
+		{From: "/older-a/", To: "/a.html", Source: "/src/a.md", Alias: true},
+	}
+	got := GatherRedirects(s, targets)
+	if len(expected) != len(got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if expected[i] != got[i] {
+			t.Errorf("%d: expected %+v, got %+v", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestRenderRedirectMaps(t *testing.T) {
+	redirects := []Redirect{
+		{From: "/2013/1/2/foo.html", To: "/2013/01/02/foo.html"},
+		{From: "/old foo/", To: "/new foo/"},
+	}
+	for format, expected := range map[string]string{
+		"netlify": "# Generated by grender.\n" +
+			"/2013/1/2/foo.html /2013/01/02/foo.html 301\n" +
+			"/old%20foo/ /new%20foo/ 301\n",
+		"nginx": "# Generated by grender. Include in the http block, and add\n" +
+			"#   if ($grender_redirect) { return 301 $grender_redirect; }\n" +
+			"# to the server block.\n" +
+			"map $uri $grender_redirect {\n" +
+			"\t/2013/1/2/foo.html /2013/01/02/foo.html;\n" +
+			"\t\"/old foo/\" \"/new foo/\";\n" +
+			"}\n",
+		"apache": "# Generated by grender.\n" +
+			"RedirectMatch 301 ^/2013/1/2/foo\\.html$ /2013/01/02/foo.html\n" +
+			"RedirectMatch 301 \"^/old foo/$\" /new%20foo/\n",
+	} {
+		if got := string(RedirectMaps[format].Render(redirects)); expected != got {
+			t.Errorf("%s: expected\n%s\ngot\n%s", format, expected, got)
+		}
+	}
+}
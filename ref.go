@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/russross/blackfriday"
+)
+
+// Ref returns the URL of the source file name, looked up in files, the Global
+// Key metadata. name is relative to the source directory, unless it begins
+// with "./" or "../", in which case it's relative to the file at path. It may
+// end in an #anchor, which is kept. Ref returns an error if the file doesn't
+// exist, or isn't published.
+func Ref(files map[string]interface{}, path, name string) (string, error) {
+	if strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../") {
+		return resolveRef(files, path, name)
+	}
+	return resolveRef(files, path, "/"+strings.TrimPrefix(name, "/"))
+}
+
+// MarkdownRef resolves the destination of a Markdown link in the file at path
+// to a URL, if it refers to another source file: that is, if it's a relative
+// link to a .md file. Like links on GitHub, it's relative to the file at path,
+// unless it begins with "/". Other links are returned as-is.
+func MarkdownRef(files map[string]interface{}, path, link string) (string, error) {
+	if !IsSourceLink(link) {
+		return link, nil
+	}
+	return resolveRef(files, path, link)
+}
+
+// IsSourceLink reports whether the link refers to a Markdown source file,
+// rather than to a URL.
+func IsSourceLink(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.RawQuery != "" {
+		return false
+	}
+	return strings.ToLower(path.Ext(u.Path)) == ".md"
+}
+
+// resolveRef looks up name, relative to the file at path unless it begins with
+// "/", in files, and returns its URL.
+func resolveRef(files map[string]interface{}, path, name string) (string, error) {
+	anchor := ""
+	if i := strings.Index(name, "#"); i >= 0 {
+		name, anchor = name[:i], name[i:]
+	}
+	filename := filepath.Join(filepath.Dir(path), filepath.FromSlash(name))
+	if strings.HasPrefix(name, "/") {
+		filename = filepath.Join(*sourceDir, filepath.FromSlash(name))
+	}
+	if !strings.HasPrefix(filename, *sourceDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("ref %s: outside of the source directory", name)
+	}
+	m := files
+	for _, level := range SplitPath(Relative(*sourceDir, filename)) {
+		next, ok := m[level].(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("ref %s: %s doesn't exist, or isn't published", name, Relative(*sourceDir, filename))
+		}
+		m = next
+	}
+	url, ok := m["url"].(string)
+	if !ok {
+		return "", fmt.Errorf("ref %s: %s isn't a page", name, Relative(*sourceDir, filename))
+	}
+	return url + anchor, nil
+}
+
+// refRenderer is a Markdown renderer which passes the destination of every
+// link through resolve. It records the first error resolve returns.
+type refRenderer struct {
+	blackfriday.Renderer
+	resolve func(string) (string, error)
+	err     error
+}
+
+func (r *refRenderer) Link(out *bytes.Buffer, link []byte, title []byte, content []byte) {
+	resolved, err := r.resolve(string(link))
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	if err == nil {
+		link = []byte(resolved)
+	}
+	r.Renderer.Link(out, link, title, content)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testFiles() map[string]interface{} {
+	return map[string]interface{}{
+		"index.html": map[string]interface{}{"url": "/index.html"},
+		"blog": map[string]interface{}{
+			"2013-01-02-first-entry.md": map[string]interface{}{"url": "/blog/2013/01/02/first-entry.html"},
+			"index.md":                  map[string]interface{}{"url": "/blog/index.html"},
+		},
+	}
+}
+
+func TestRef(t *testing.T) {
+	path := filepath.Join(*sourceDir, "blog", "index.md")
+	for name, expected := range map[string]string{
+		"blog/2013-01-02-first-entry.md":        "/blog/2013/01/02/first-entry.html",
+		"/blog/2013-01-02-first-entry.md#intro": "/blog/2013/01/02/first-entry.html#intro",
+		"./2013-01-02-first-entry.md":           "/blog/2013/01/02/first-entry.html",
+		"../index.html":                         "/index.html",
+	} {
+		got, err := Ref(testFiles(), path, name)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if expected != got {
+			t.Errorf("%s: expected %s, got %s", name, expected, got)
+		}
+	}
+	for _, name := range []string{"blog/missing.md", "blog", "../../outside.md", "2013-01-02-first-entry.md"} {
+		if _, err := Ref(testFiles(), path, name); err == nil {
+			t.Errorf("%s: expected error, got none", name)
+		}
+	}
+}
+
+func TestMarkdownRefs(t *testing.T) {
+	path := filepath.Join(*sourceDir, "blog", "index.md")
+	links := func(link string) (string, error) { return MarkdownRef(testFiles(), path, link) }
+	for input, expected := range map[string]string{
+		"[first](2013-01-02-first-entry.md)":                 `<a href="/blog/2013/01/02/first-entry.html">first</a>`,
+		"[first](/blog/2013-01-02-first-entry.md)":           `<a href="/blog/2013/01/02/first-entry.html">first</a>`,
+		"[first][1]\n\n[1]: 2013-01-02-first-entry.md#intro": `<a href="/blog/2013/01/02/first-entry.html#intro">first</a>`,
+		"[home](../index.html)":                              `<a href="../index.html">home</a>`,
+		"[readme](https://example.com/README.md)":            `<a href="https://example.com/README.md">readme</a>`,
+	} {
+		output, err := RenderMarkdown([]byte(input), 0, 0, links)
+		if err != nil {
+			t.Errorf("%q: %s", input, err)
+			continue
+		}
+		if got := string(output); !strings.Contains(got, expected) {
+			t.Errorf("%q: expected %s, got %s", input, expected, got)
+		}
+	}
+	if _, err := RenderMarkdown([]byte("[gone](gone.md)"), 0, 0, links); err == nil {
+		t.Errorf("expected error for a missing file, got none")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	// InvalidPages lists every page whose metadata violates its schema.
+	InvalidPages = []string{}
+)
+
+// Validate checks metadata against the schema in its "schema" key, and
+// returns every violation. A schema lists the keys which are "required", and
+// the "types" of keys, which are checked if they're present:
+//
+//	{ "schema": { "required": ["title"], "types": { "tags": "[]string" } } }
+//
+// The types are string, number, bool, date, list, map, and []T for a list
+// whose elements are all of type T. Like any other metadata, schemas are
+// layered: a subdirectory can check more types, or require more keys by
+// appending to "required" with the $append merge directive.
+func Validate(metadata map[string]interface{}) []string {
+	declared, ok := metadata["schema"]
+	if !ok {
+		return []string{}
+	}
+	schema, ok := declared.(map[string]interface{})
+	if !ok {
+		return []string{"bad schema: must be a map"}
+	}
+
+	violations := []string{}
+	required, ok := toStrings(schema["required"])
+	if !ok {
+		violations = append(violations, "bad schema: required must be a list of keys")
+	}
+	for _, key := range required {
+		if _, ok := metadata[key]; !ok {
+			violations = append(violations, fmt.Sprintf("%s is required", key))
+		}
+	}
+
+	types := map[string]interface{}{}
+	if declared, ok := schema["types"]; ok {
+		if types, ok = declared.(map[string]interface{}); !ok {
+			violations = append(violations, "bad schema: types must be a map of keys to types")
+		}
+	}
+	keys := []string{}
+	for key := range types {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		t, ok := types[key].(string)
+		if !ok || !knownType(t) {
+			violations = append(violations, fmt.Sprintf("bad schema: unknown type %v for %s", types[key], key))
+			continue
+		}
+		if v, ok := metadata[key]; ok && !hasType(v, t) {
+			violations = append(violations, fmt.Sprintf("%s must be a %s, not %s", key, t, typeName(v)))
+		}
+	}
+	return violations
+}
+
+func knownType(t string) bool {
+	switch strings.TrimPrefix(t, "[]") {
+	case "string", "number", "bool", "date", "list", "map":
+		return true
+	}
+	return false
+}
+
+func hasType(v interface{}, t string) bool {
+	if strings.HasPrefix(t, "[]") {
+		if !hasType(v, "list") {
+			return false
+		}
+		elements, _ := Items(v)
+		for _, element := range elements {
+			if !hasType(element, t[2:]) {
+				return false
+			}
+		}
+		return true
+	}
+	switch t {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := number(v)
+		return ok
+	case "bool":
+		_, ok := v.(bool)
+		return ok
+	case "date":
+		_, ok := ToDate(v)
+		return ok
+	case "list":
+		switch v.(type) {
+		case []interface{}, []string:
+			return true
+		}
+	case "map":
+		_, ok := v.(map[string]interface{})
+		return ok
+	}
+	return false
+}
+
+// typeName describes the type of the metadata value v in a schema's terms.
+func typeName(v interface{}) string {
+	for _, t := range []string{"string", "number", "bool", "list", "map", "date"} {
+		if hasType(v, t) {
+			return t
+		}
+	}
+	if v == nil {
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	schema := map[string]interface{}{
+		"required": []interface{}{"title", "date"},
+		"types": map[string]interface{}{
+			"title":  "string",
+			"date":   "date",
+			"tags":   "[]string",
+			"weight": "number",
+			"draft":  "bool",
+			"author": "map",
+		},
+	}
+	valid := map[string]interface{}{
+		"schema": schema,
+		"title":  "Hello",
+		"date":   time.Now(),
+		"tags":   []interface{}{"go", "web"},
+		"weight": 2.0,
+		"author": map[string]interface{}{"name": "Jane"},
+	}
+	if got := Validate(valid); len(got) != 0 {
+		t.Errorf("expected no violations, got %v", got)
+	}
+
+	invalid := map[string]interface{}{
+		"schema": schema,
+		"tags":   "go",
+		"weight": "heavy",
+		"draft":  "no",
+		"author": []interface{}{"Jane"},
+	}
+	expected := []string{
+		"title is required",
+		"date is required",
+		"author must be a map, not list",
+		"draft must be a bool, not string",
+		"tags must be a []string, not string",
+		"weight must be a number, not string",
+	}
+	if got := Validate(invalid); !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected\n%q\ngot\n%q", expected, got)
+	}
+
+	if got := Validate(map[string]interface{}{"tags": []interface{}{"go", 1.0}, "schema": map[string]interface{}{
+		"types": map[string]interface{}{"tags": "[]string", "x": "uuid"},
+	}}); !reflect.DeepEqual([]string{"tags must be a []string, not list", "bad schema: unknown type uuid for x"}, got) {
+		t.Errorf("got %q", got)
+	}
+	if got := Validate(map[string]interface{}{"title": 1.0}); len(got) != 0 {
+		t.Errorf("expected no violations without a schema, got %v", got)
+	}
+}
+
+func TestValidateLayeredSchemas(t *testing.T) {
+	s := NewStack()
+	s.Add("/blog", map[string]interface{}{"schema": map[string]interface{}{
+		"required": []interface{}{"title"},
+	}})
+	s.Add("/blog/replaced", map[string]interface{}{"schema": map[string]interface{}{
+		"required": []interface{}{"author"},
+	}})
+	s.Add("/blog/appended", map[string]interface{}{"schema": map[string]interface{}{
+		"required": map[string]interface{}{"$append": []interface{}{"author"}},
+	}})
+
+	for path, expected := range map[string][]string{
+		"/blog/x.md":          {"title is required"},
+		"/blog/replaced/x.md": {"author is required"},
+		"/blog/appended/x.md": {"title is required", "author is required"},
+	} {
+		if got := Validate(s.Get(path)); !reflect.DeepEqual(expected, got) {
+			t.Errorf("%s: expected %q, got %q", path, expected, got)
+		}
+	}
+}
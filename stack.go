@@ -2,16 +2,19 @@ package main
 
 import (
 	"path/filepath"
-
-	"github.com/peterbourgon/mergemap"
+	"reflect"
 )
 
 type StackReader interface {
 	Get(path string) map[string]interface{}
+	GetLayered(path string, extra map[string][]map[string]interface{}) map[string]interface{}
 }
 
 type StackWriter interface {
 	Add(path string, m map[string]interface{})
+	AddNamed(path, name string, m map[string]interface{})
+	AddComplete(path, name string, m map[string]interface{})
+	AddOrigin(path string, o Origin)
 }
 
 type StackReadWriter interface {
@@ -31,45 +34,200 @@ type StackReadWriter interface {
 // "/foo/bar", and "/foo/bar/baz", preferring keys from more explicit (deeper)
 // paths. In this way, Stack enables the 'stackable' Grender context behavior.
 type Stack struct {
-	m map[string]map[string]interface{} // path: partial-metadata
+	m       map[string][]Origin // path: partial-metadata, in the order it was added
+	origins map[string][]Origin // path: where its metadata came from
+}
+
+// Origin names a source of some of the metadata in a Stack element, such as a
+// .json file, or a source file's front matter, for Provenance. Unnamed
+// metadata is named by the key of its Stack element.
+type Origin struct {
+	Name     string
+	Metadata map[string]interface{}
+	Default  bool   // beneath every other layer, like a source file's defaults
+	Over     string // key of the Stack element it's layered over, if not its own
+}
+
+// Provenance is the final value of a metadata key, and the names of the layers
+// which set or changed it, in order; the last one won.
+type Provenance struct {
+	Value  interface{}
+	Layers []string
 }
 
 func NewStack() *Stack {
 	return &Stack{
-		m: map[string]map[string]interface{}{},
+		m:       map[string][]Origin{},
+		origins: map[string][]Origin{},
 	}
 }
 
-// Add merges the given metadata into the Stack element represented by path.
-// If no such element exists, Add will create it.
+// Add layers the given metadata onto the Stack element represented by path.
+// If no such element exists, Add will create it. Merge directives in the
+// metadata are applied by Get, so they work across elements.
 func (s *Stack) Add(path string, m map[string]interface{}) {
-	key := filepath.Join(SplitPath(path)...)
+	s.AddNamed(path, "", m)
+}
 
-	existing, ok := s.m[key]
-	if !ok {
-		existing = map[string]interface{}{}
+// AddNamed is like Add, but names where the metadata came from, for
+// Provenance.
+func (s *Stack) AddNamed(path, name string, m map[string]interface{}) {
+	key := StackKey(path)
+	s.m[key] = append(s.m[key], Origin{Name: name, Metadata: m})
+}
+
+// AddComplete is like AddNamed, but m is the complete metadata of path, with
+// everything it inherits already merged in, as GatherSource computes it for a
+// source file. Get returns it as it is, rather than merging it over what it
+// inherits again, which would undo merge directives like $remove; only keys
+// added to the path's ancestors later are inherited.
+func (s *Stack) AddComplete(path, name string, m map[string]interface{}) {
+	layer := map[string]interface{}{}
+	for k := range s.Get(path) {
+		layer[k] = map[string]interface{}{"$remove": true}
+	}
+	for k, v := range m {
+		layer[k] = map[string]interface{}{"$replace": v}
+	}
+	s.AddNamed(path, name, layer)
+}
+
+// AddOrigin records that the metadata o came from o.Name, for Provenance. It
+// doesn't change what Get returns: it's meant to explain metadata which was
+// Added as a whole, such as a source file's, which includes its defaults and
+// its front matter.
+func (s *Stack) AddOrigin(path string, o Origin) {
+	key := StackKey(path)
+	s.origins[key] = append(s.origins[key], o)
+}
+
+// Provenance returns, for every key in the metadata Get returns for path, its
+// value and the layers which set or changed it, from global metadata to the
+// path itself. Layers are named by their Origins, if they were given any; if
+// not, or if they don't account for all of a Stack element's metadata, by the
+// element's key ("" for global metadata).
+func (s *Stack) Provenance(path string) map[string]Provenance {
+	provenance := map[string]Provenance{}
+	m := map[string]interface{}{}
+	apply := func(name string, layer map[string]interface{}) {
+		before := map[string]interface{}{}
+		for k := range layer {
+			before[k] = m[k]
+		}
+		m = MergeMetadata(m, layer)
+		for k := range layer {
+			if _, existed := provenance[k]; existed && reflect.DeepEqual(before[k], m[k]) {
+				continue // e.g. a copy of inherited metadata
+			}
+			provenance[k] = Provenance{Layers: append(provenance[k].Layers, name)}
+		}
 	}
 
-	s.m[key] = mergemap.Merge(existing, m)
+	layers, own := s.Layers(path), s.origins[StackKey(path)]
+	for _, key := range layers {
+		for _, o := range s.origins[key] {
+			if o.Default {
+				apply(o.Name, o.Metadata)
+			}
+		}
+	}
+	for _, key := range layers {
+		for _, o := range s.origins[key] {
+			if !o.Default && o.Over == "" {
+				apply(o.Name, o.Metadata)
+			}
+		}
+		for _, layer := range s.m[key] {
+			if layer.Name == "" {
+				layer.Name = key
+			}
+			apply(layer.Name, layer.Metadata)
+		}
+		for _, o := range own {
+			if !o.Default && o.Over == key {
+				apply(o.Name, o.Metadata)
+			}
+		}
+	}
+
+	for k, p := range provenance {
+		if _, ok := m[k]; !ok {
+			delete(provenance, k) // removed
+			continue
+		}
+		p.Value = m[k]
+		provenance[k] = p
+	}
+	return provenance
 }
 
 // Get returns the aggregate metadata visible from the given path.
 func (s *Stack) Get(path string) map[string]interface{} {
+	return s.GetLayered(path, nil)
+}
+
+// GetLayered is like Get, but layers the extra metadata over the Stack
+// elements with the same keys, as if it had been added to them last.
+func (s *Stack) GetLayered(path string, extra map[string][]map[string]interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	for _, key := range StackPaths(path) {
+		for _, layer := range s.m[key] {
+			m = MergeMetadata(m, layer.Metadata)
+		}
+		for _, layer := range extra[key] {
+			m = MergeMetadata(m, layer)
+		}
+	}
+	return m
+}
+
+// Layers returns the keys of the Stack elements which Get merges for the
+// given path, in order, beginning with "" for global metadata, if there is
+// any.
+func (s *Stack) Layers(path string) []string {
+	layers := []string{}
+	for _, key := range StackPaths(path) {
+		if _, ok := s.m[key]; ok {
+			layers = append(layers, key)
+		}
+	}
+	return layers
+}
+
+// Layer returns the metadata added to the Stack with exactly the given key,
+// or nil if there isn't any.
+func (s *Stack) Layer(key string) map[string]interface{} {
+	layers, ok := s.m[key]
+	if !ok {
+		return nil
+	}
+	m := map[string]interface{}{}
+	for _, layer := range layers {
+		m = MergeMetadata(m, layer.Metadata)
+	}
+	return m
+}
+
+// StackKey returns the key of the Stack element Add creates for path.
+func StackKey(path string) string {
+	return filepath.Join(SplitPath(path)...)
+}
+
+// StackPaths returns the keys of every Stack element visible from the given
+// path, from "" (global) to the path itself.
+func StackPaths(path string) []string {
 	list := SplitPath(path)
 	if len(list) <= 0 {
-		return map[string]interface{}{}
+		return []string{}
 	}
 
 	// A weird bit of trickery. We add global metadata with a path of "" (empty
 	// string) under the expectation that Get will return them for every input
 	// path. So, we prepend "" to every lookup request. That means 'i' is off-
 	// by-one, so we can use it directly against the list slice.
-	m := map[string]interface{}{}
+	keys := []string{}
 	for i, _ := range append([]string{""}, list...) {
-		key := filepath.Join(list[:i]...)
-		if m0, ok := s.m[key]; ok {
-			m = mergemap.Merge(m, m0)
-		}
+		keys = append(keys, filepath.Join(list[:i]...))
 	}
-	return m
+	return keys
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/peterbourgon/mergemap"
+	"reflect"
 	"testing"
 )
 
@@ -101,3 +102,107 @@ func TestMergeInto(t *testing.T) {
 		t.Fatal("m3[b] != d")
 	}
 }
+
+func TestLayers(t *testing.T) {
+	s := NewStack()
+	s.Add("", map[string]interface{}{"g": 1})
+	s.Add("/a", map[string]interface{}{"a": 1})
+	s.Add("/a/b/c.md", map[string]interface{}{"c": 1})
+
+	if expected, got := []string{"", "a", "a/b", "a/b/c.md"}, StackPaths("/a/b/c.md"); !reflect.DeepEqual(expected, got) {
+		t.Errorf("StackPaths: expected %q, got %q", expected, got)
+	}
+	if expected, got := []string{"", "a", "a/b/c.md"}, s.Layers("/a/b/c.md"); !reflect.DeepEqual(expected, got) {
+		t.Errorf("Layers: expected %q, got %q", expected, got)
+	}
+	if got := s.Layer("a"); !reflect.DeepEqual(map[string]interface{}{"a": 1}, got) {
+		t.Errorf("Layer: got %v", got)
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	s := NewStack()
+	add := s.AddNamed
+	add("/docs", "docs/_.json", map[string]interface{}{"layout": "doc", "nav": map[string]interface{}{"a": 1}})
+	add("/docs/v1", "docs/v1/_.json", map[string]interface{}{"layout": "doc", "version": "1"})
+	add("/docs/v1/api", "docs/v1/api/_.json", map[string]interface{}{"layout": "api", "nav": map[string]interface{}{"b": 2}})
+
+	// A source file's element holds its complete metadata: defaults, then
+	// inherited metadata, then its front matter, then computed keys.
+	defaults := map[string]interface{}{"layout": "page", "slug": "x", "sortkey": "x.md"}
+	front := map[string]interface{}{"slug": "intro"}
+	complete := mergemap.Merge(mergemap.Merge(map[string]interface{}{}, defaults), s.Get("/docs/v1/api/x.md"))
+	complete = mergemap.Merge(complete, front)
+	complete["url"] = "/docs/v1/api/intro.html"
+	s.Add("/docs/v1/api/x.md", complete)
+	s.AddOrigin("/docs/v1/api/x.md", Origin{Name: "x.md (defaults)", Metadata: defaults, Default: true})
+	s.AddOrigin("/docs/v1/api/x.md", Origin{Name: "x.md (front matter)", Metadata: front})
+	add("", "", map[string]interface{}{"files": map[string]interface{}{}})
+
+	expected := map[string]Provenance{
+		"layout":  {"api", []string{"x.md (defaults)", "docs/_.json", "docs/v1/api/_.json"}},
+		"version": {"1", []string{"docs/v1/_.json"}},
+		"nav":     {map[string]interface{}{"a": 1, "b": 2}, []string{"docs/_.json", "docs/v1/api/_.json"}},
+		"slug":    {"intro", []string{"x.md (defaults)", "x.md (front matter)"}},
+		"sortkey": {"x.md", []string{"x.md (defaults)"}},
+		"url":     {"/docs/v1/api/intro.html", []string{"docs/v1/api/x.md"}},
+		"files":   {map[string]interface{}{}, []string{""}},
+	}
+	got := s.Provenance("/docs/v1/api/x.md")
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected\n%v\ngot\n%v", expected, got)
+	}
+	final := s.Get("/docs/v1/api/x.md")
+	for k, p := range got {
+		if !reflect.DeepEqual(final[k], p.Value) {
+			t.Errorf("%s: Get returns %v, Provenance %v", k, final[k], p.Value)
+		}
+	}
+}
+
+func TestGetMergeDirectives(t *testing.T) {
+	s := NewStack()
+	s.Add("", map[string]interface{}{"tags": []interface{}{"site"}, "draft": true})
+	s.AddNamed("/blog", "blog/_.json", map[string]interface{}{
+		"tags":   map[string]interface{}{"$append": []interface{}{"blog"}},
+		"author": map[string]interface{}{"name": "Jane", "email": "jane@example.com"},
+	})
+	s.AddNamed("/blog", "blog/extra.json", map[string]interface{}{
+		"tags": map[string]interface{}{"$append": "extra"},
+	})
+	s.AddNamed("/blog/2013", "blog/2013/_.json", map[string]interface{}{
+		"tags":   map[string]interface{}{"$prepend": []interface{}{"old"}},
+		"draft":  map[string]interface{}{"$remove": true},
+		"author": map[string]interface{}{"$replace": map[string]interface{}{"name": "Joe"}},
+	})
+	s.AddNamed("/blog/2013/06", "blog/2013/06/_.json", map[string]interface{}{
+		"tags":   map[string]interface{}{"$append": []interface{}{"june"}},
+		"author": map[string]interface{}{"url": "http://joe.example.com"},
+	})
+
+	expected := map[string]interface{}{
+		"tags":   []interface{}{"old", "site", "blog", "extra", "june"},
+		"author": map[string]interface{}{"name": "Joe", "url": "http://joe.example.com"},
+	}
+	if got := s.Get("/blog/2013/06/post.md"); !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected\n%v\ngot\n%v", expected, got)
+	}
+
+	expected = map[string]interface{}{
+		"tags":   []interface{}{"site", "blog", "extra"},
+		"draft":  true,
+		"author": map[string]interface{}{"name": "Jane", "email": "jane@example.com"},
+	}
+	if got := s.Get("/blog/post.md"); !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected\n%v\ngot\n%v", expected, got)
+	}
+
+	provenance := s.Provenance("/blog/2013/06/post.md")
+	if _, ok := provenance["draft"]; ok {
+		t.Errorf("draft was removed, but has provenance %v", provenance["draft"])
+	}
+	layers := []string{"", "blog/_.json", "blog/extra.json", "blog/2013/_.json", "blog/2013/06/_.json"}
+	if got := provenance["tags"].Layers; !reflect.DeepEqual(layers, got) {
+		t.Errorf("tags: expected layers %v, got %v", layers, got)
+	}
+}